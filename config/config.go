@@ -0,0 +1,229 @@
+// Package config loads cluebatbot's config file. It's YAML or JSON, versioned, and
+// overridable from the environment so secrets can come from k8s instead of the file
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/craigske/cluebatbot/cslack"
+	"sigs.k8s.io/yaml"
+)
+
+// CurrentVersion is the schema this build writes. Version 0 is the old bare list of
+// servers, which still loads
+const CurrentVersion = 1
+
+// Config is the whole file
+type Config struct {
+	Version int      `json:"Version"`
+	Redis   Redis    `json:"Redis"`
+	HTTP    HTTP     `json:"HTTP"`
+	Logging Logging  `json:"Logging"`
+	Servers []Server `json:"Servers"`
+}
+
+// Redis is where the state lives
+type Redis struct {
+	// Host is host:port. Default localhost:6379
+	Host     string `json:"Host"`
+	Password string `json:"Password,omitempty"`
+}
+
+// HTTP is the server for the events API, slash commands, metrics and health checks
+type HTTP struct {
+	// Port defaults to 2000
+	Port string `json:"Port"`
+	// ServiceDNS is the name slack reaches us on, for logging request URLs. Default localhost
+	ServiceDNS string `json:"ServiceDNS"`
+}
+
+// Logging turns on the chattier logs
+type Logging struct {
+	Debug bool `json:"Debug"`
+	// Verbosity is glog's -v
+	Verbosity int `json:"Verbosity"`
+	// CSlackDebug and LatencyTick are cslack's -debugCSlack and -debugLatencyTick
+	CSlackDebug bool `json:"CSlackDebug"`
+	LatencyTick bool `json:"LatencyTick"`
+}
+
+// Server is one slack workspace. Everything past Features is optional tuning, see
+// cslack.SlackServer for the defaults
+type Server struct {
+	Name string `json:"Name"`
+	// Token is the xoxb- bot token
+	Token string `json:"Token"`
+	// AppToken is the xapp- token, only needed for the socket transport
+	AppToken string `json:"AppToken,omitempty"`
+	// SigningSecret verifies slash commands, buttons and the http transport
+	SigningSecret string `json:"SigningSecret,omitempty"`
+	// ControlChannel gets connection notices, reports and alerts
+	ControlChannel string `json:"ControlChannel,omitempty"`
+	// Owners are user ids that always hold the owner role
+	Owners []string `json:"Owners"`
+	// Transport is rtm (the default), http or socket
+	Transport     string          `json:"Transport,omitempty"`
+	CommandPrefix string          `json:"CommandPrefix,omitempty"`
+	Features      map[string]bool `json:"Features,omitempty"`
+
+	SlackAPIURL              string                `json:"SlackAPIURL,omitempty"`
+	ConversationCacheSeconds int                   `json:"ConversationCacheSeconds,omitempty"`
+	ChannelPolicy            *cslack.ChannelPolicy `json:"ChannelPolicy,omitempty"`
+	RateLimits               *cslack.RateLimits    `json:"RateLimits,omitempty"`
+	DirectoryRefreshSeconds  int                   `json:"DirectoryRefreshSeconds,omitempty"`
+	LatencyWindow            int                   `json:"LatencyWindow,omitempty"`
+	LatencyRetentionHours    int                   `json:"LatencyRetentionHours,omitempty"`
+	LatencyAlerts            []cslack.LatencyAlert `json:"LatencyAlerts,omitempty"`
+}
+
+// legacyServer is a version 0 entry, which was cslack.SlackServer as it used to be
+type legacyServer struct {
+	Server
+	APIKey         string `json:"APIKey"`
+	CluebatBotChan string `json:"CluebatBotChan"`
+	OwnerID        string `json:"OwnerID"`
+}
+
+// Load reads, overrides from the environment and validates a config file. A
+// *ValidationError lists everything wrong with it at once
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	cfg.applyEnv(os.LookupEnv)
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Parse decodes a config in either format. Unknown fields are an error, so typos don't
+// quietly fall back to defaults
+func Parse(data []byte) (*Config, error) {
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(js), []byte("[")) {
+		return parseLegacy(js)
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(js, &cfg); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Version == 0:
+		return nil, fmt.Errorf("Version is missing, this build reads version %d", CurrentVersion)
+	case cfg.Version > CurrentVersion:
+		return nil, fmt.Errorf("version %d is newer than this build reads (%d)", cfg.Version, CurrentVersion)
+	}
+	return &cfg, nil
+}
+
+func parseLegacy(js []byte) (*Config, error) {
+	var legacy []legacyServer
+	if err := yaml.Unmarshal(js, &legacy); err != nil {
+		return nil, err
+	}
+	cfg := &Config{Version: 0}
+	for _, l := range legacy {
+		server := l.Server
+		server.Token = l.APIKey
+		server.ControlChannel = l.CluebatBotChan
+		if l.OwnerID != "" {
+			server.Owners = []string{l.OwnerID}
+		}
+		cfg.Servers = append(cfg.Servers, server)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) applyDefaults() {
+	if cfg.Redis.Host == "" {
+		cfg.Redis.Host = "localhost:6379"
+	}
+	if cfg.HTTP.Port == "" {
+		cfg.HTTP.Port = "2000"
+	}
+	if cfg.HTTP.ServiceDNS == "" {
+		cfg.HTTP.ServiceDNS = "localhost"
+	}
+}
+
+// SlackServers is what cslack runs
+func (cfg *Config) SlackServers() []cslack.SlackServer {
+	servers := make([]cslack.SlackServer, 0, len(cfg.Servers))
+	for _, s := range cfg.Servers {
+		servers = append(servers, s.SlackServer())
+	}
+	return servers
+}
+
+// SlackServer maps the config onto cslack's
+func (s Server) SlackServer() cslack.SlackServer {
+	server := cslack.SlackServer{
+		Name:                     s.Name,
+		APIKey:                   s.Token,
+		AppToken:                 s.AppToken,
+		SigningSecret:            s.SigningSecret,
+		CluebatBotChan:           s.ControlChannel,
+		Owners:                   s.Owners,
+		Transport:                s.Transport,
+		CommandPrefix:            s.CommandPrefix,
+		Features:                 s.Features,
+		SlackAPIURL:              s.SlackAPIURL,
+		ConversationCacheSeconds: s.ConversationCacheSeconds,
+		DirectoryRefreshSeconds:  s.DirectoryRefreshSeconds,
+		LatencyWindow:            s.LatencyWindow,
+		LatencyRetentionHours:    s.LatencyRetentionHours,
+		LatencyAlerts:            s.LatencyAlerts,
+	}
+	if s.ChannelPolicy != nil {
+		server.ChannelPolicy = *s.ChannelPolicy
+	}
+	if s.RateLimits != nil {
+		server.RateLimits = *s.RateLimits
+	}
+	return server
+}
+
+// Example is a config to start from
+func Example() *Config {
+	return &Config{
+		Version: CurrentVersion,
+		Redis:   Redis{Host: "localhost:6379"},
+		HTTP:    HTTP{Port: "2000", ServiceDNS: "localhost"},
+		Servers: []Server{
+			{
+				Name:           "example-server1",
+				Token:          "xoxb-token1",
+				SigningSecret:  "signing secret 1",
+				ControlChannel: "C1111111",
+				Owners:         []string{"U1111111"},
+				CommandPrefix:  "!cb",
+				Features:       map[string]bool{"bat": true, "die": false},
+			},
+			{
+				Name:      "example-server2",
+				Token:     "xoxb-token2",
+				AppToken:  "xapp-token2",
+				Owners:    []string{"U2222222", "U3333333"},
+				Transport: cslack.TransportSocket,
+			},
+		},
+	}
+}
+
+// Marshal writes a config as YAML
+func Marshal(cfg *Config) ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlConfig = `
+Version: 1
+Redis:
+  Host: redis:6379
+Servers:
+- Name: work
+  Token: xoxb-work
+  Owners: [U1111111]
+  ControlChannel: C1111111
+  Features:
+    bat: true
+`
+
+const jsonConfig = `{
+  "Version": 1,
+  "Redis": {"Host": "redis:6379"},
+  "Servers": [{
+    "Name": "work",
+    "Token": "xoxb-work",
+    "Owners": ["U1111111"],
+    "ControlChannel": "C1111111",
+    "Features": {"bat": true}
+  }]
+}`
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		Version: 1,
+		Redis:   Redis{Host: "redis:6379"},
+		Servers: []Server{{
+			Name:           "work",
+			Token:          "xoxb-work",
+			Owners:         []string{"U1111111"},
+			ControlChannel: "C1111111",
+			Features:       map[string]bool{"bat": true},
+		}},
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want *Config
+		err  string
+	}{
+		{"yaml", yamlConfig, want, ""},
+		{"json", jsonConfig, want, ""},
+		{"legacy array", `[{
+			"Name": "work",
+			"APIKey": "xoxb-work",
+			"CluebatBotChan": "C1111111",
+			"OwnerID": "U1111111",
+			"Features": {"bat": true}
+		}]`, &Config{Version: 0, Servers: want.Servers}, ""},
+		{"legacy yaml array", `
+- Name: work
+  APIKey: xoxb-work
+  CluebatBotChan: C1111111
+  OwnerID: U1111111
+  Features:
+    bat: true
+`, &Config{Version: 0, Servers: want.Servers}, ""},
+		{"no version", "Servers: []", nil, "Version is missing"},
+		{"newer version", "Version: 99", nil, "version 99 is newer"},
+		{"unknown field", "Version: 1\nRedsi:\n  Host: x:1", nil, "Redsi"},
+		{"not yaml", "Version: [", nil, "yaml"},
+	}
+	for _, tt := range tests {
+		got, err := Parse([]byte(tt.data))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want one mentioning %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyServerMapsOntoCSlack(t *testing.T) {
+	cfg, err := Parse([]byte(`[{"Name": "old", "APIKey": "xoxb-old", "CluebatBotChan": "C1", "OwnerID": "U1"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := cfg.SlackServers()
+	if len(servers) != 1 {
+		t.Fatalf("got %d servers, want 1", len(servers))
+	}
+	s := servers[0]
+	if s.Name != "old" || s.APIKey != "xoxb-old" || s.CluebatBotChan != "C1" || !reflect.DeepEqual(s.Owners, []string{"U1"}) {
+		t.Errorf("legacy server became %+v", s)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"REDIS_HOST":                   "env-redis:6380",
+		"CLUEBATBOT_PORT":              "",
+		"CSLACK_DEBUG":                 "true",
+		"CLUEBATBOT_LOG_VERBOSITY":     "2",
+		"CLUEBATBOT_WORK_TOKEN":        "xoxb-from-env",
+		"CLUEBATBOT_MY_TEAM_APP_TOKEN": "xapp-from-env",
+		"CLUEBATBOT_OTHER_TOKEN":       "xoxb-not-ours",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	cfg, err := Parse([]byte(`
+Version: 1
+HTTP:
+  Port: "3000"
+Servers:
+- Name: work
+  Token: xoxb-file
+  Owners: [U1]
+- Name: my-team
+  Token: xoxb-file-2
+  Owners: [U1]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.applyEnv(lookup)
+	cfg.applyDefaults()
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"env beats the file", cfg.Servers[0].Token, "xoxb-from-env"},
+		{"file kept without env", cfg.Servers[1].Token, "xoxb-file-2"},
+		{"names become env prefixes", cfg.Servers[1].AppToken, "xapp-from-env"},
+		{"empty env leaves the file alone", cfg.HTTP.Port, "3000"},
+		{"env beats the default", cfg.Redis.Host, "env-redis:6380"},
+		{"default fills the rest", cfg.HTTP.ServiceDNS, "localhost"},
+		{"bools", cfg.Logging.CSlackDebug, true},
+		{"ints", cfg.Logging.Verbosity, 2},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	for name, want := range map[string]string{
+		"work":       "CLUEBATBOT_WORK_",
+		"my-team.io": "CLUEBATBOT_MY_TEAM_IO_",
+		"Team2":      "CLUEBATBOT_TEAM2_",
+	} {
+		if got := EnvPrefix(name); got != want {
+			t.Errorf("EnvPrefix(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := Example()
+		cfg.applyDefaults()
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("the example config doesn't validate: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mangle func(cfg *Config)
+		want   string
+	}{
+		{"redis host", func(cfg *Config) { cfg.Redis.Host = "redis" }, `Redis.Host "redis" should be host:port`},
+		{"port", func(cfg *Config) { cfg.HTTP.Port = "http" }, `HTTP.Port "http" isn't a port number`},
+		{"verbosity", func(cfg *Config) { cfg.Logging.Verbosity = -1 }, "Logging.Verbosity can't be negative"},
+		{"no servers", func(cfg *Config) { cfg.Servers = nil }, "Servers is empty"},
+		{"no name", func(cfg *Config) { cfg.Servers[0].Name = "" }, "Servers[0]: Name is required"},
+		{"bad name", func(cfg *Config) { cfg.Servers[0].Name = "a b" }, `Servers[0] (a b): Name "a b" can only have`},
+		{"duplicate name", func(cfg *Config) { cfg.Servers[1].Name = cfg.Servers[0].Name }, "Servers[1] (example-server1): Name is used by another server"},
+		{"no token", func(cfg *Config) { cfg.Servers[0].Token = "" }, "Servers[0] (example-server1): Token is required, in the file or CLUEBATBOT_EXAMPLE_SERVER1_TOKEN"},
+		{"http without secret", func(cfg *Config) {
+			cfg.Servers[1].Transport = "http"
+			cfg.Servers[1].SigningSecret = ""
+		}, "Servers[1] (example-server2): the http transport needs SigningSecret"},
+		{"socket without app token", func(cfg *Config) { cfg.Servers[1].AppToken = "" }, "Servers[1] (example-server2): the socket transport needs an xapp- AppToken"},
+		{"unknown transport", func(cfg *Config) { cfg.Servers[0].Transport = "carrier-pigeon" }, `Servers[0] (example-server1): Transport "carrier-pigeon" should be`},
+		{"no owners", func(cfg *Config) { cfg.Servers[0].Owners = nil }, "Servers[0] (example-server1): Owners needs at least one user id"},
+		{"bad owner", func(cfg *Config) { cfg.Servers[0].Owners = []string{"craig"} }, `Servers[0] (example-server1): owner "craig" doesn't look like a user id`},
+		{"bad control channel", func(cfg *Config) { cfg.Servers[0].ControlChannel = "#general" }, `Servers[0] (example-server1): ControlChannel "#general" doesn't look like a channel id`},
+		{"unknown feature", func(cfg *Config) { cfg.Servers[0].Features["btt"] = true }, `Servers[0] (example-server1): Features has "btt", which isn't a command`},
+		{"negative cache", func(cfg *Config) { cfg.Servers[1].ConversationCacheSeconds = -1 }, "Servers[1] (example-server2): ConversationCacheSeconds can't be negative"},
+	}
+	for _, tt := range tests {
+		cfg := valid()
+		tt.mangle(cfg)
+		err := cfg.Validate()
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: Validate() = %v, want a *ValidationError", tt.name, err)
+			continue
+		}
+		if len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], tt.want) {
+			t.Errorf("%s: problems %q, want one starting %q", tt.name, verr.Problems, tt.want)
+		}
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	cfg := Example()
+	cfg.applyDefaults()
+	cfg.Servers[0].Token = ""
+	cfg.Servers[1].Owners = []string{"nobody"}
+	err := cfg.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Fatalf("Validate() = %v, want both problems", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "2 problem(s)") || !strings.Contains(msg, "example-server1") || !strings.Contains(msg, "example-server2") {
+		t.Errorf("error %q should count the problems and name both servers", msg)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluebatbot-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.yaml")
+	if err := ioutil.WriteFile(good, []byte(yamlConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTP.Port != "2000" {
+		t.Errorf("Load didn't apply defaults, port is %q", cfg.HTTP.Port)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := ioutil.WriteFile(bad, []byte(`{"Version": 1, "Servers": [{"Name": "work"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(bad); err == nil || !strings.Contains(err.Error(), "Servers[0] (work): Token is required") {
+		t.Errorf("Load(bad) = %v, want the missing token named", err)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Load of a missing file should fail")
+	}
+}
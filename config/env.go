@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// applyEnv lets the environment win over the file. The globals use the names the k8s
+// deployment already sets. Each server's secrets can come from CLUEBATBOT_<NAME>_TOKEN,
+// _APP_TOKEN, _SIGNING_SECRET and _CONTROL_CHANNEL, with NAME upper cased and anything
+// that isn't a letter or digit turned into _
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) {
+	setString := func(dst *string, key string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	setBool := func(dst *bool, key string) {
+		if v, ok := lookup(key); ok {
+			*dst = v == "true"
+		}
+	}
+
+	setString(&cfg.Redis.Host, "REDIS_HOST")
+	setString(&cfg.Redis.Password, "REDIS_PASSWORD")
+	setString(&cfg.HTTP.Port, "CLUEBATBOT_PORT")
+	setString(&cfg.HTTP.ServiceDNS, "CLUEBATBOT_SERVICE_DNS")
+	setBool(&cfg.Logging.Debug, "CLUEBATBOT_DEBUG")
+	setBool(&cfg.Logging.CSlackDebug, "CSLACK_DEBUG")
+	setBool(&cfg.Logging.LatencyTick, "CSLACK_DEBUG_LATENCY_TICK")
+	if v, ok := lookup("CLUEBATBOT_LOG_VERBOSITY"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Logging.Verbosity = n
+		}
+	}
+
+	for i := range cfg.Servers {
+		server := &cfg.Servers[i]
+		prefix := EnvPrefix(server.Name)
+		setString(&server.Token, prefix+"TOKEN")
+		setString(&server.AppToken, prefix+"APP_TOKEN")
+		setString(&server.SigningSecret, prefix+"SIGNING_SECRET")
+		setString(&server.ControlChannel, prefix+"CONTROL_CHANNEL")
+	}
+}
+
+// EnvPrefix is where a server's environment overrides start, e.g. CLUEBATBOT_WORK_
+func EnvPrefix(name string) string {
+	return "CLUEBATBOT_" + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name) + "_"
+}
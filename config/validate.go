@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/craigske/cluebatbot/cslack"
+)
+
+// ValidationError is everything wrong with a config, so it can all be fixed in one go
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("config has %d problem(s):\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+var (
+	// server names end up in redis keys, URLs and env var names
+	serverNameRE = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	userIDRE     = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+	channelIDRE  = regexp.MustCompile(`^[CGD][A-Z0-9]+$`)
+)
+
+// Validate checks the config after overrides and defaults
+func (cfg *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Redis.Host); err != nil {
+		add("Redis.Host %q should be host:port", cfg.Redis.Host)
+	}
+	if port, err := strconv.Atoi(cfg.HTTP.Port); err != nil || port < 1 || port > 65535 {
+		add("HTTP.Port %q isn't a port number", cfg.HTTP.Port)
+	}
+	if cfg.Logging.Verbosity < 0 {
+		add("Logging.Verbosity can't be negative")
+	}
+	if len(cfg.Servers) == 0 {
+		add("Servers is empty, there's nothing to run")
+	}
+
+	seen := make(map[string]bool)
+	for i, server := range cfg.Servers {
+		where := fmt.Sprintf("Servers[%d]", i)
+		if server.Name != "" {
+			where += " (" + server.Name + ")"
+		}
+		for _, problem := range server.validate() {
+			add("%s: %s", where, problem)
+		}
+		if server.Name != "" && seen[server.Name] {
+			add("%s: Name is used by another server", where)
+		}
+		seen[server.Name] = true
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (s Server) validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case s.Name == "":
+		add("Name is required")
+	case !serverNameRE.MatchString(s.Name):
+		add("Name %q can only have letters, digits, '.', '_' and '-'", s.Name)
+	}
+	if s.Token == "" {
+		add("Token is required, in the file or %sTOKEN", EnvPrefix(s.Name))
+	}
+
+	switch s.Transport {
+	case "", cslack.TransportRTM:
+	case cslack.TransportHTTP:
+		if s.SigningSecret == "" {
+			add("the http transport needs SigningSecret")
+		}
+	case cslack.TransportSocket:
+		if !strings.HasPrefix(s.AppToken, "xapp-") {
+			add("the socket transport needs an xapp- AppToken")
+		}
+	default:
+		add("Transport %q should be %s, %s or %s", s.Transport, cslack.TransportRTM, cslack.TransportHTTP, cslack.TransportSocket)
+	}
+
+	if len(s.Owners) == 0 {
+		add("Owners needs at least one user id")
+	}
+	for _, owner := range s.Owners {
+		if !userIDRE.MatchString(owner) {
+			add("owner %q doesn't look like a user id, e.g. U1234ABCD", owner)
+		}
+	}
+	if s.ControlChannel != "" && !channelIDRE.MatchString(s.ControlChannel) {
+		add("ControlChannel %q doesn't look like a channel id, e.g. C1234ABCD", s.ControlChannel)
+	}
+
+	for _, name := range sortedKeys(s.Features) {
+		if _, ok := cslack.LookupCommand(name); !ok {
+			add("Features has %q, which isn't a command", name)
+		}
+	}
+
+	if policy := s.ChannelPolicy; policy != nil {
+		for _, pattern := range append(append([]string{}, policy.Allow...), policy.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				add("ChannelPolicy pattern %q is malformed", pattern)
+			}
+		}
+		for _, pattern := range sortedKeys(policy.Weights) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				add("ChannelPolicy pattern %q is malformed", pattern)
+			}
+			if policy.Weights[pattern] < 0 {
+				add("ChannelPolicy weight for %q can't be negative", pattern)
+			}
+		}
+	}
+
+	if s.ConversationCacheSeconds < 0 {
+		add("ConversationCacheSeconds can't be negative")
+	}
+	if s.DirectoryRefreshSeconds < 0 {
+		add("DirectoryRefreshSeconds can't be negative")
+	}
+	if s.LatencyWindow < 0 {
+		add("LatencyWindow can't be negative")
+	}
+	if s.LatencyRetentionHours < 0 {
+		add("LatencyRetentionHours can't be negative")
+	}
+
+	for i, rule := range s.LatencyAlerts {
+		name := rule.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if rule.ThresholdMillis == 0 {
+			add("LatencyAlerts[%s] needs ThresholdMillis, or -1 to turn it off", name)
+		}
+		if rule.ResolveMillis > rule.ThresholdMillis && rule.ThresholdMillis > 0 {
+			add("LatencyAlerts[%s] ResolveMillis should be at or under ThresholdMillis", name)
+		}
+		switch rule.Notify {
+		case "", "channel", "owner":
+		default:
+			add("LatencyAlerts[%s] Notify %q should be channel or owner", name, rule.Notify)
+		}
+	}
+	return problems
+}
+
+// sortedKeys keeps problems in the same order run to run
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]float64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package cslack
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// batRequest is someone asking for a cluebat to land on someone else
+type batRequest struct {
+	Sender string `json:"Sender"`
+	Target string `json:"Target"`
+	// Tag limits the templates to ones with this tag. Optional
+	Tag string `json:"Tag"`
+}
+
+// noChannelError is what deliverClueBat returns when the target isn't anywhere a bat may
+// land, as opposed to somewhere it couldn't land just now
+type noChannelError struct {
+	msg string
+}
+
+func (e noChannelError) Error() string {
+	return e.msg
+}
+
+// deliverClueBat finds one of the target's channels, drops a cluebat in it and records
+// it in the ledger. Returned errors are fit to show the sender
+func deliverClueBat(slackAPI *slack.Client, server *SlackServer, req batRequest) (BatEvent, error) {
+	optedOut, err := isOptedOut(server, req.Target)
+	if err != nil {
+		glog.Errorf("%s error checking if %s opted out: %s", server.Name, req.Target, err)
+		return BatEvent{}, fmt.Errorf("I couldn't check if <@%s> wants cluebats just now", req.Target)
+	}
+	if optedOut {
+		return BatEvent{}, optedOutError{Target: req.Target}
+	}
+	quotaID := newQuotaID()
+	if err := reserveBatLimits(server, req, quotaID); err != nil {
+		return BatEvent{}, err
+	}
+	delivered := false
+	defer func() {
+		if !delivered {
+			refundBat(server, BatEvent{Sender: req.Sender, Target: req.Target, QuotaID: quotaID})
+		}
+	}()
+	members, err := getUserConversations(slackAPI, server, req.Target)
+	if err != nil {
+		glog.Errorf("%s error getting conversations for %s was %s", server.Name, req.Target, err)
+		if rateLimited, ok := err.(*slack.RateLimitedError); ok {
+			return BatEvent{}, fmt.Errorf("Slack wants me to slow down. Try again shortly, %s", retryWhen(rateLimited.RetryAfter))
+		}
+		return BatEvent{}, fmt.Errorf("I couldn't look up <@%s>'s channels just now", req.Target)
+	}
+	if len(members) == 0 {
+		glog.Infof("%s %s has no conversations I can find. Harassment failure", server.Name, req.Target)
+		return BatEvent{}, noChannelError{fmt.Sprintf("I can't find any channels <@%s> is in", req.Target)}
+	}
+
+	// walk the channels in the selector's order until one takes the bat
+	r := rand.New(rand.NewSource(time.Now().UnixNano() * 99)) // random seed + salt is probably enough :)
+	selector := NewChannelSelector(server.ChannelPolicy, r)
+	if server.ChannelPolicy.PreferQuiet {
+		members = withMemberCounts(server.directory(), members)
+	}
+	candidates := selector.Order(members)
+	if len(candidates) == 0 {
+		glog.Infof("%s %s is only in channels the policy won't bat in. Harassment failure", server.Name, req.Target)
+		return BatEvent{}, noChannelError{fmt.Sprintf("<@%s> is only in channels I'm not allowed to bat in", req.Target)}
+	}
+	count, err := batCount(server, req.Target)
+	if err != nil {
+		glog.Errorf("%s error counting bats for %s: %s", server.Name, req.Target, err)
+	}
+	var channelRetry time.Duration
+	for _, member := range candidates {
+		if ok, retryAfter := reserveChannel(server, member.ID, quotaID); !ok {
+			if channelRetry == 0 || retryAfter < channelRetry {
+				channelRetry = retryAfter
+			}
+			if *debugCSlack {
+				glog.Infof("%s %s has had enough bats for now, skipping it", server.Name, member.ID)
+			}
+			continue
+		}
+		if *debugCSlack {
+			glog.Infof("%s trying %s (%s) to harass %s in", server.Name, member.ID, member.Name, req.Target)
+		}
+		_, err := slackAPI.JoinChannel(member.Name)
+		if err != nil {
+			glog.Errorf("%s error joining channel %s to harass user %s: %s", server.Name, member.Name, req.Target, err)
+			countSlackError(server, "channels.join")
+		}
+		// leave whether or not the bat lands, so a failed post doesn't strand the bot there
+		leave := func() {
+			if _, err := slackAPI.LeaveChannel(member.Name); err != nil {
+				glog.Errorf("%s error leaving channel %s - %s while harassing %s: %s", server.Name, member.ID, member.Name, req.Target, err)
+				countSlackError(server, "channels.leave")
+			}
+		}
+		//send message to random channel
+		batMsg, template, err := clueBatMessage(server, req.Tag, BatTemplateData{
+			Target:  "<@" + req.Target + ">",
+			Sender:  "<@" + req.Sender + ">",
+			Channel: "<#" + member.ID + ">",
+			Count:   count + 1,
+		}, r)
+		if err != nil {
+			refundChannel(server, member.ID, quotaID)
+			leave()
+			return BatEvent{}, err
+		}
+		_, timestamp, err := sendSlackMessage(slack.MessageEvent{}, batMsg, member.ID, *slackAPI, server, batMessageBlocks(batMsg)...)
+		if err != nil {
+			glog.Errorf("%s error harassing %s in random channel %s - %s, trying the next one: %s", server.Name, req.Target, member.ID, member.Name, err)
+			refundChannel(server, member.ID, quotaID)
+			leave()
+			continue
+		}
+		//leave random channel
+		leave()
+
+		event := BatEvent{
+			Sender:    req.Sender,
+			Target:    req.Target,
+			Channel:   member.ID,
+			Template:  template.ID,
+			Timestamp: slackTimestampToTime(timestamp),
+			MessageTS: timestamp,
+			QuotaID:   quotaID,
+		}
+		event, err = recordBat(server, event)
+		if err != nil {
+			glog.Errorf("%s error recording bat on %s in the ledger: %s", server.Name, req.Target, err)
+		}
+		delivered = true
+		batsCounter.WithLabelValues(server.Name).Inc()
+		glog.Infof("A cluebat was sent on %s to %s by %s in %s at %s",
+			server.Name, req.Target, req.Sender, member.Name, event.Timestamp.String())
+		return event, nil
+	}
+	if channelRetry > 0 {
+		return BatEvent{}, fmt.Errorf("<@%s>'s channels have had enough cluebats for now. Try again %s", req.Target, retryWhen(channelRetry))
+	}
+	return BatEvent{}, fmt.Errorf("I couldn't get a cluebat into any of <@%s>'s channels", req.Target)
+}
+
+// slackTimestampToTime turns a message ts like "1525215129.000001" into a time
+func slackTimestampToTime(timestamp string) time.Time {
+	seconds, err := strconv.ParseFloat(timestamp, 64)
+	if err != nil {
+		glog.Errorf("error converting slack timestamp %s, using now instead: %s", timestamp, err)
+		return time.Now()
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
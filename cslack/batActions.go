@@ -0,0 +1,150 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// Action ids for the buttons on bats and bat confirmations
+const (
+	actionBatUndo   = "bat_undo"
+	actionBatAgain  = "bat_again"
+	actionBatReport = "bat_report"
+)
+
+func init() {
+	RegisterAction(actionBatUndo, undoBatAction)
+	RegisterAction(actionBatAgain, batAgainAction)
+	RegisterAction(actionBatReport, reportBatAction)
+}
+
+func mrkdwnSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+func button(actionID, value, text string, style slack.Style) *slack.ButtonBlockElement {
+	b := slack.NewButtonBlockElement(actionID, value, slack.NewTextBlockObject(slack.PlainTextType, text, false, false))
+	if style != "" {
+		b.WithStyle(style)
+	}
+	return b
+}
+
+// batValue is what the confirmation buttons carry to find their bat again
+func batValue(event BatEvent) string {
+	return event.Channel + " " + event.MessageTS
+}
+
+// batMessageBlocks is the bat as it lands in the target's channel. The report button
+// doesn't say who sent it, the ledger does
+func batMessageBlocks(batMsg string) []slack.Block {
+	return []slack.Block{
+		mrkdwnSection(batMsg),
+		slack.NewActionBlock("", button(actionBatReport, "", "Report abuse", "")),
+	}
+}
+
+// batConfirmationBlocks is what the sender gets back, with undo and bat again buttons
+func batConfirmationBlocks(msg string, event BatEvent) []slack.Block {
+	undo := button(actionBatUndo, batValue(event), "Undo", slack.StyleDanger)
+	undo.Confirm = slack.NewConfirmationBlockObject(
+		slack.NewTextBlockObject(slack.PlainTextType, "Undo this cluebat?", false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("I'll delete it from <#%s>", event.Channel), false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Undo", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Keep it", false, false),
+	)
+	return []slack.Block{
+		mrkdwnSection(msg),
+		slack.NewActionBlock("", undo, button(actionBatAgain, batValue(event), "Bat again", slack.StylePrimary)),
+	}
+}
+
+// clickedBat finds the bat a confirmation button was for
+func clickedBat(a *ActionContext) (BatEvent, string, bool, error) {
+	parts := strings.Fields(a.Action.Value)
+	if len(parts) != 2 {
+		return BatEvent{}, "", false, fmt.Errorf("bad bat button value %q", a.Action.Value)
+	}
+	return batByMessage(a.Server, parts[0], parts[1])
+}
+
+func undoBatAction(a *ActionContext) error {
+	event, raw, found, err := clickedBat(a)
+	if err != nil {
+		a.Reply("I couldn't find that cluebat just now. Try again in a bit.")
+		return err
+	}
+	if !found {
+		return a.Reply("that cluebat is already gone")
+	}
+	if a.Callback.User.ID != event.Sender {
+		return a.Reply("only the person who swung can take it back")
+	}
+	if _, _, err := a.SlackAPI.DeleteMessage(event.Channel, event.MessageTS); err != nil {
+		countSlackError(a.Server, "chat.delete")
+		a.Reply(fmt.Sprintf("I couldn't delete it from <#%s>: %s", event.Channel, err))
+		return err
+	}
+	if err := forgetBat(a.Server, event, raw); err != nil {
+		glog.Errorf("%s error removing bat %s from the ledger: %s", a.Server.Name, event.ID, err)
+	}
+	// a bat taken back doesn't count against anyone's limits. Bats from before the ledger
+	// kept quota ids have nothing to refund, and still count until their window passes
+	refundBat(a.Server, event)
+	glog.Infof("%s %s took back their cluebat on %s in %s", a.Server.Name, event.Sender, event.Target, event.Channel)
+	return a.Reply(fmt.Sprintf("un-batted <@%s>. Nobody saw anything", event.Target))
+}
+
+func batAgainAction(a *ActionContext) error {
+	event, _, found, err := clickedBat(a)
+	if err != nil {
+		a.Reply("I couldn't find that cluebat just now. Try again in a bit.")
+		return err
+	}
+	if !found {
+		return a.Reply("I don't remember that cluebat any more, use `bat` instead")
+	}
+	sender := a.Callback.User.ID
+	if cmd, ok := LookupCommand("bat"); ok {
+		if !cmd.Enabled(a.Server) {
+			return a.Reply("`bat` is turned off on this server")
+		}
+		allowed, why, err := authorize(a.Server, sender, cmd)
+		if err != nil {
+			glog.Errorf("%s error checking roles for %s: %s", a.Server.Name, sender, err)
+		}
+		if !allowed {
+			return a.Reply(why)
+		}
+	}
+	again, err := deliverClueBat(a.SlackAPI, a.Server, batRequest{Sender: sender, Target: event.Target})
+	if err != nil {
+		return a.Reply(err.Error())
+	}
+	msg := fmt.Sprintf("sent <@%s> another cluebat in <#%s> at %s", again.Target, again.Channel, again.Timestamp.String())
+	return a.ReplyBlocks(msg, batConfirmationBlocks(msg, again)...)
+}
+
+// reportBatAction tells the server's owners who sent a bat someone didn't like
+func reportBatAction(a *ActionContext) error {
+	reporter := a.Callback.User.ID
+	event, _, found, err := batByMessage(a.Server, a.Callback.Channel.ID, a.Callback.Message.Timestamp)
+	if err != nil {
+		a.Reply("I couldn't look that cluebat up just now. Try again in a bit.")
+		return err
+	}
+	if !found {
+		return a.Reply("I don't have a record of that cluebat, sorry")
+	}
+	report := fmt.Sprintf(":rotating_light: <@%s> reported a cluebat: <@%s> batted <@%s> in <#%s> %s (bat %s, template `%s`)",
+		reporter, event.Sender, event.Target, event.Channel, slackDate(event.Timestamp), event.ID, event.Template)
+	if err := tellOwners(a.SlackAPI, a.Server, report); err != nil {
+		a.Reply("I couldn't reach the owners just now. Try again in a bit.")
+		return err
+	}
+	glog.Infof("%s %s reported bat %s", a.Server.Name, reporter, event.ID)
+	return a.Reply("thanks, I've told the owners")
+}
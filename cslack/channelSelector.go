@@ -0,0 +1,139 @@
+package cslack
+
+import (
+	"math"
+	"path"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// defaultDeny is used when a server doesn't set its own Deny list
+var defaultDeny = []string{"announcements"}
+
+// ChannelPolicy is a server's rules for which channels cluebats may land in. Patterns are
+// path.Match globs against the channel name (without the #) or its id
+type ChannelPolicy struct {
+	// Allow, when set, limits bats to channels matching one of these patterns
+	Allow []string `json:"Allow"`
+	// Deny patterns are never used. Defaults to announcements
+	Deny []string `json:"Deny"`
+	// Weights multiply the odds of channels matching a pattern. Unmatched channels weigh 1
+	Weights map[string]float64 `json:"Weights"`
+	// PreferQuiet favours channels with fewer members. The counts come from the directory,
+	// see withMemberCounts
+	PreferQuiet bool `json:"PreferQuiet"`
+}
+
+// RNG is the part of math/rand the selector uses, so tests can hand it something predictable
+type RNG interface {
+	Float64() float64
+}
+
+// ChannelSelector picks where a cluebat goes according to a ChannelPolicy
+type ChannelSelector struct {
+	Policy ChannelPolicy
+	RNG    RNG
+}
+
+// NewChannelSelector makes a selector. A *rand.Rand works as the rng
+func NewChannelSelector(policy ChannelPolicy, rng RNG) *ChannelSelector {
+	return &ChannelSelector{Policy: policy, RNG: rng}
+}
+
+func channelMatches(patterns []string, channel slack.Channel) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "#")
+		if ok, _ := path.Match(pattern, channel.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, channel.ID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Eligible reports whether a bat may land in channel at all
+func (s *ChannelSelector) Eligible(channel slack.Channel) bool {
+	if channel.IsArchived {
+		return false
+	}
+	deny := s.Policy.Deny
+	if deny == nil {
+		deny = defaultDeny
+	}
+	if channelMatches(deny, channel) {
+		return false
+	}
+	if len(s.Policy.Allow) > 0 && !channelMatches(s.Policy.Allow, channel) {
+		return false
+	}
+	return true
+}
+
+// Weight is how likely channel is to be picked relative to the others
+func (s *ChannelSelector) Weight(channel slack.Channel) float64 {
+	weight := 1.0
+	for pattern, w := range s.Policy.Weights {
+		if channelMatches([]string{pattern}, channel) {
+			weight *= w
+		}
+	}
+	if s.Policy.PreferQuiet && channel.NumMembers > 0 {
+		weight /= math.Sqrt(float64(channel.NumMembers))
+	}
+	return weight
+}
+
+// withMemberCounts copies channels with NumMembers filled in from the directory.
+// users.conversations, where bat candidates come from, leaves the count out, but
+// conversations.list, which the directory syncs from, has it
+func withMemberCounts(directory *Directory, channels []slack.Channel) []slack.Channel {
+	counted := make([]slack.Channel, len(channels))
+	for i, channel := range channels {
+		if known, ok := directory.Channel(channel.ID); ok && channel.NumMembers == 0 {
+			channel.NumMembers = known.NumMembers
+		}
+		counted[i] = channel
+	}
+	return counted
+}
+
+// Order returns the eligible candidates in the order they should be tried. It is a
+// weighted random shuffle, so the first entry is the pick and the rest are the fallbacks
+// if joining or posting there fails. The order only depends on the candidates and the rng
+func (s *ChannelSelector) Order(candidates []slack.Channel) []slack.Channel {
+	var pool []slack.Channel
+	var weights []float64
+	for _, channel := range candidates {
+		if !s.Eligible(channel) {
+			continue
+		}
+		if w := s.Weight(channel); w > 0 {
+			pool = append(pool, channel)
+			weights = append(weights, w)
+		}
+	}
+
+	ordered := make([]slack.Channel, 0, len(pool))
+	for len(pool) > 0 {
+		var total float64
+		for _, w := range weights {
+			total += w
+		}
+		target := s.RNG.Float64() * total
+		pick := len(pool) - 1
+		for i, w := range weights {
+			if target < w {
+				pick = i
+				break
+			}
+			target -= w
+		}
+		ordered = append(ordered, pool[pick])
+		pool = append(pool[:pick], pool[pick+1:]...)
+		weights = append(weights[:pick], weights[pick+1:]...)
+	}
+	return ordered
+}
@@ -0,0 +1,133 @@
+package cslack
+
+import (
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// fixedRNG hands out the same rolls every run, repeating the last one if it runs out
+type fixedRNG struct {
+	rolls []float64
+	next  int
+}
+
+func (r *fixedRNG) Float64() float64 {
+	roll := r.rolls[r.next]
+	if r.next < len(r.rolls)-1 {
+		r.next++
+	}
+	return roll
+}
+
+func testChannel(id string, name string) slack.Channel {
+	var channel slack.Channel
+	channel.ID = id
+	channel.Name = name
+	return channel
+}
+
+func channelNames(channels []slack.Channel) []string {
+	var names []string
+	for _, channel := range channels {
+		names = append(names, channel.Name)
+	}
+	return names
+}
+
+func TestChannelSelectorEligible(t *testing.T) {
+	archived := testChannel("C9", "old")
+	archived.IsArchived = true
+
+	tests := []struct {
+		name    string
+		policy  ChannelPolicy
+		channel slack.Channel
+		want    bool
+	}{
+		{"plain channel", ChannelPolicy{}, testChannel("C1", "general"), true},
+		{"archived", ChannelPolicy{}, archived, false},
+		{"announcements denied by default", ChannelPolicy{}, testChannel("C2", "announcements"), false},
+		{"own deny replaces the default", ChannelPolicy{Deny: []string{"random"}}, testChannel("C2", "announcements"), true},
+		{"empty deny replaces the default", ChannelPolicy{Deny: []string{}}, testChannel("C2", "announcements"), true},
+		{"deny glob", ChannelPolicy{Deny: []string{"hr-*"}}, testChannel("C3", "hr-private"), false},
+		{"deny with a #", ChannelPolicy{Deny: []string{"#random"}}, testChannel("C4", "random"), false},
+		{"deny by id", ChannelPolicy{Deny: []string{"C4"}}, testChannel("C4", "random"), false},
+		{"allow glob matches", ChannelPolicy{Allow: []string{"eng-*"}}, testChannel("C5", "eng-web"), true},
+		{"allow glob misses", ChannelPolicy{Allow: []string{"eng-*"}}, testChannel("C1", "general"), false},
+		{"deny beats allow", ChannelPolicy{Allow: []string{"eng-*"}, Deny: []string{"eng-oncall"}}, testChannel("C6", "eng-oncall"), false},
+		{"allow still keeps the default deny", ChannelPolicy{Allow: []string{"*"}}, testChannel("C2", "announcements"), false},
+	}
+	for _, tt := range tests {
+		s := NewChannelSelector(tt.policy, &fixedRNG{rolls: []float64{0}})
+		if got := s.Eligible(tt.channel); got != tt.want {
+			t.Errorf("%s: Eligible(#%s) = %v, want %v", tt.name, tt.channel.Name, got, tt.want)
+		}
+	}
+}
+
+func TestChannelSelectorOrder(t *testing.T) {
+	archived := testChannel("C4", "random")
+	archived.IsArchived = true
+	candidates := []slack.Channel{
+		testChannel("C1", "general"),
+		testChannel("C2", "announcements"),
+		testChannel("C3", "eng-web"),
+		archived,
+		testChannel("C5", "eng-ops"),
+	}
+	policy := ChannelPolicy{Weights: map[string]float64{"eng-*": 3}}
+
+	// the pool weighs general 1, eng-web 3 and eng-ops 3. A roll of 0.5 lands 3.5 into 7,
+	// inside eng-web. Then 0 picks the first left, general, leaving eng-ops
+	s := NewChannelSelector(policy, &fixedRNG{rolls: []float64{0.5, 0, 0.9}})
+	got := channelNames(s.Order(candidates))
+	want := []string{"eng-web", "general", "eng-ops"}
+	if len(got) != len(want) {
+		t.Fatalf("Order = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Order = %v, want %v", got, want)
+		}
+	}
+
+	// the same rolls give the same order
+	again := channelNames(NewChannelSelector(policy, &fixedRNG{rolls: []float64{0.5, 0, 0.9}}).Order(candidates))
+	for i := range want {
+		if again[i] != got[i] {
+			t.Fatalf("second Order = %v, want %v", again, got)
+		}
+	}
+}
+
+func TestChannelSelectorPreferQuiet(t *testing.T) {
+	server := testServer("quiet", "BOT1", "TEAM1")
+	server.directory().updateChannel("C1", func(c *slack.Channel) { c.Name = "busy"; c.NumMembers = 100 })
+	server.directory().updateChannel("C2", func(c *slack.Channel) { c.Name = "quiet"; c.NumMembers = 4 })
+
+	// users.conversations leaves the counts out
+	candidates := []slack.Channel{testChannel("C1", "busy"), testChannel("C2", "quiet")}
+	counted := withMemberCounts(server.directory(), candidates)
+	if counted[0].NumMembers != 100 || counted[1].NumMembers != 4 {
+		t.Fatalf("counts = %d, %d, want 100, 4", counted[0].NumMembers, counted[1].NumMembers)
+	}
+	if candidates[0].NumMembers != 0 {
+		t.Errorf("withMemberCounts changed its input")
+	}
+
+	// evenly weighted, a roll of 0.3 lands in busy. Preferring quiet, busy weighs 1/10 and
+	// quiet 1/2, so the same roll lands in quiet
+	roll := []float64{0.3}
+	if got := NewChannelSelector(ChannelPolicy{}, &fixedRNG{rolls: roll}).Order(counted); got[0].Name != "busy" {
+		t.Errorf("without PreferQuiet picked #%s, want #busy", got[0].Name)
+	}
+	quiet := ChannelPolicy{PreferQuiet: true}
+	if got := NewChannelSelector(quiet, &fixedRNG{rolls: roll}).Order(counted); got[0].Name != "quiet" {
+		t.Errorf("with PreferQuiet picked #%s, want #quiet", got[0].Name)
+	}
+	// without the directory's counts PreferQuiet has nothing to go on
+	if got := NewChannelSelector(quiet, &fixedRNG{rolls: roll}).Order(candidates); got[0].Name != "busy" {
+		t.Errorf("with PreferQuiet and no counts picked #%s, want #busy", got[0].Name)
+	}
+}
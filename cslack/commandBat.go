@@ -0,0 +1,75 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:  "bat",
+		Usage: "hit <user> with a cluebat in a random channel they're in. They will never see it coming",
+		Help: "add a tag, e.g. `bat @user gentle`, to only use templates with that tag.\n" +
+			"`bat @user in 2h` or `bat @user at 17:00` waits before swinging. " +
+			"`pending` lists your waiting bats and `cancel <id>` calls one off.",
+		Args:    []ArgSpec{{Name: "user", Kind: ArgUser}, {Name: "tag|in 2h|at 17:00", Optional: true, Variadic: true}},
+		Role:    RoleBatter,
+		Handler: batCommand,
+	})
+}
+
+func batCommand(c *CommandContext) error {
+	req := batRequest{
+		Sender: c.Event.User,
+		Target: c.Args[0].Value,
+	}
+	var due time.Time
+	var tags []string
+	for i := 1; i < len(c.Args); i++ {
+		word := strings.ToLower(c.Args[i].Value)
+		if (word == "in" || word == "at") && i+1 < len(c.Args) && due.IsZero() {
+			var err error
+			due, err = parseBatTime(word, c.Args[i+1].Value, time.Now(), userLocation(c.Server, req.Sender))
+			if err != nil {
+				return c.Reply(err.Error())
+			}
+			i++
+			continue
+		}
+		tags = append(tags, c.Args[i].Value)
+	}
+	// templates are matched on one tag, so "gentle savage" would never match anything
+	if len(tags) > 1 {
+		return c.Reply(fmt.Sprintf("one tag at a time please, e.g. `bat <@%s> %s`", req.Target, tags[0]))
+	}
+	if len(tags) == 1 {
+		req.Tag = tags[0]
+	}
+	if *debugCSlack {
+		glog.Infof("%s got clue for %s\ncmd: %s object: %s tag: %s due: %s", c.Server.Name, req.Target, c.Name, c.Args[0].Raw, req.Tag, due)
+	}
+
+	if !due.IsZero() {
+		job, err := scheduleBat(c.Server, req, due)
+		if err != nil {
+			return c.Reply(fmt.Sprintf("couldn't schedule that: %s", err))
+		}
+		return c.Reply(fmt.Sprintf("cluebat `%s` for <@%s> will swing %s. `cancel %s` to call it off",
+			job.ID, req.Target, slackDate(job.Due), job.ID))
+	}
+
+	event, err := deliverClueBat(c.SlackAPI, c.Server, req)
+	if _, optedOut := err.(optedOutError); optedOut {
+		// tell the sender privately so the channel doesn't learn who tried
+		return sendDirectMessage(c.SlackAPI, c.Server, req.Sender, err.Error())
+	}
+	if err != nil {
+		return c.Reply(err.Error())
+	}
+	msg := fmt.Sprintf("sent <@%s> a cluebat message in <#%s> at %s\n If you join right away, they'll totally know it was you. <GRIN>",
+		event.Target, event.Channel, event.Timestamp.String())
+	return c.ReplyBlocks(msg, batConfirmationBlocks(msg, event)...)
+}
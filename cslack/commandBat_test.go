@@ -0,0 +1,29 @@
+package cslack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBatCommandTags(t *testing.T) {
+	testRedis(t)
+	server := testServer("tags", "BOT1", "TEAM1")
+	if err := grantRole(server, "USENDER", RoleBatter.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := runCommand(t, server, "USENDER", "bat <@U2> gentle savage")
+	if len(replies) != 1 || !strings.Contains(replies[0], "one tag at a time") {
+		t.Errorf("two tags got %q, want a usage reply", replies)
+	}
+
+	// one tag, around a time, is kept whole
+	runCommand(t, server, "USENDER", "bat <@U2> in 2h gentle")
+	jobs, err := pendingBats(server, "USENDER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Request.Tag != "gentle" {
+		t.Errorf("scheduled %+v, want one bat tagged gentle", jobs)
+	}
+}
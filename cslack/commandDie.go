@@ -0,0 +1,20 @@
+package cslack
+
+import "github.com/golang/glog"
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "die",
+		Usage:   "shut cluebatbot down",
+		Role:    RoleOwner,
+		Handler: dieCommand,
+		Hidden:  true,
+		// nobody wants a random pod kill switch in prod unless they asked for it
+		DisabledByDefault: true,
+	})
+}
+
+func dieCommand(c *CommandContext) error {
+	glog.Fatalln(c.Server.Name + " got die from " + c.Event.User)
+	return nil
+}
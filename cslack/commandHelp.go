@@ -0,0 +1,49 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "help",
+		Usage:   "list commands, or show the details of one",
+		Args:    []ArgSpec{{Name: "command", Optional: true}},
+		Handler: helpCommand,
+	})
+}
+
+func helpCommand(c *CommandContext) error {
+	if len(c.Args) > 0 {
+		cmd, ok := LookupCommand(c.Args[0].Value)
+		if !ok || cmd.Hidden || !cmd.Enabled(c.Server) {
+			return c.Reply(fmt.Sprintf("I don't know a command called `%s`. Try `help`", c.Args[0].Value))
+		}
+		return c.Reply(commandHelpText(cmd))
+	}
+	var sb strings.Builder
+	sb.WriteString("DM cluebatbot (hint hint) or @mention it in any channel")
+	if c.Server.CommandPrefix != "" {
+		fmt.Fprintf(&sb, ", or start your message with `%s`", c.Server.CommandPrefix)
+	}
+	sb.WriteString(". Commands:\n")
+	for _, cmd := range commandList {
+		if cmd.Hidden || !cmd.Enabled(c.Server) {
+			continue
+		}
+		fmt.Fprintf(&sb, "`%s` - %s\n", cmd.Signature(), cmd.Usage)
+	}
+	return c.Reply(sb.String())
+}
+
+func commandHelpText(cmd *Command) string {
+	text := fmt.Sprintf("`%s` - %s", cmd.Signature(), cmd.Usage)
+	if len(cmd.Aliases) > 0 {
+		text += fmt.Sprintf("\naliases: %s", strings.Join(cmd.Aliases, ", "))
+	}
+	if cmd.Help != "" {
+		text += "\n" + cmd.Help
+	}
+	return text
+}
@@ -0,0 +1,36 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+)
+
+const historySize = 10
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "history",
+		Usage:   "the last few cluebats that hit <user>, and who sent them",
+		Args:    []ArgSpec{{Name: "user", Kind: ArgUser}},
+		Role:    RoleAdmin,
+		Handler: historyCommand,
+	})
+}
+
+func historyCommand(c *CommandContext) error {
+	target := c.Args[0].Value
+	events, err := batsAgainst(c.Server, target, historySize)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return c.Reply(fmt.Sprintf("<@%s> has never been batted", target))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "last %d cluebats on <@%s>:\n", len(events), target)
+	for _, event := range events {
+		fmt.Fprintf(&sb, "%s by <@%s> in <#%s> with template `%s`\n",
+			slackDate(event.Timestamp), event.Sender, event.Channel, event.Template)
+	}
+	return c.Reply(sb.String())
+}
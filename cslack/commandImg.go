@@ -0,0 +1,20 @@
+package cslack
+
+import "github.com/nlopes/slack"
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "img",
+		Usage:   "show off the cluebat",
+		Handler: imgCommand,
+	})
+}
+
+func imgCommand(c *CommandContext) error {
+	blocks := []slack.Block{
+		mrkdwnSection("*ClueBatBot engage!*\nI'm gonna bat you a clue"),
+		slack.NewImageBlock("http://austenblog.files.wordpress.com/2009/04/mycluebat.jpg", "a cluebat for you", "",
+			slack.NewTextBlockObject(slack.PlainTextType, "cluebat", false, false)),
+	}
+	return c.ReplyBlocks("ClueBatBot engage!", blocks...)
+}
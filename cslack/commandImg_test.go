@@ -0,0 +1,26 @@
+package cslack
+
+import (
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestImgRepliesThroughTheContext(t *testing.T) {
+	server := testServer("img", "BOT1", "TEAM1")
+	var got []slack.Block
+	c := &CommandContext{
+		Server: server,
+		reply: func(msg string, blocks []slack.Block) error {
+			got = blocks
+			return nil
+		},
+	}
+	// a nil SlackAPI panics if img posts on its own instead of replying
+	if err := imgCommand(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("img replied with %d blocks, want the text and the image", len(got))
+	}
+}
@@ -0,0 +1,43 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "latency",
+		Usage:   "how quickly slack has been answering me lately",
+		Help:    "`latency 1h` or `latency 7d` changes how far back the history goes. The default is 24h.",
+		Args:    []ArgSpec{{Name: "period", Optional: true}},
+		Handler: latencyCommand,
+	})
+}
+
+func latencyCommand(c *CommandContext) error {
+	period := 24 * time.Hour
+	label := "24h"
+	if len(c.Args) > 0 {
+		d, err := parseBatDuration(c.Args[0].Value)
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+		if d > latencyRetention(c.Server) {
+			return c.Reply(fmt.Sprintf("I only keep %s of latency history", latencyRetention(c.Server)))
+		}
+		period = d
+		label = c.Args[0].Value
+	}
+	current := c.Server.state.latency.stats()
+	history, err := latencySince(c.Server, time.Now().Add(-period))
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("latency now: %s\nlast %s: %s", current, label, history)
+	if firing := c.Server.state.alerts.firing(); len(firing) > 0 {
+		msg += fmt.Sprintf("\nalerting: %s", strings.Join(firing, ", "))
+	}
+	return c.Reply(msg)
+}
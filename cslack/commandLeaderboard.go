@@ -0,0 +1,56 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const leaderboardSize = 5
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "leaderboard",
+		Usage:   "most batted and most active batters over the last `7d` (default), `30d` or `all` time",
+		Aliases: []string{"stats"},
+		Args:    []ArgSpec{{Name: "period", Optional: true}},
+		Handler: leaderboardCommand,
+	})
+}
+
+func leaderboardCommand(c *CommandContext) error {
+	period := "7d"
+	if len(c.Args) > 0 {
+		period = strings.ToLower(c.Args[0].Value)
+	}
+	var since time.Time
+	switch period {
+	case "7d", "week":
+		since = time.Now().AddDate(0, 0, -7)
+	case "30d", "month":
+		since = time.Now().AddDate(0, 0, -30)
+	case "all":
+	default:
+		return c.Reply("usage: `leaderboard [7d|30d|all]`")
+	}
+	events, err := batsSince(c.Server, since)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return c.Reply(fmt.Sprintf("no cluebats in the last %s. Everyone has a clue, apparently", period))
+	}
+	batted, batters := leaderboard(events, leaderboardSize)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d cluebats (%s)*\n*Most batted*\n", len(events), period)
+	writeLeaderboard(&sb, batted)
+	sb.WriteString("*Most active batters*\n")
+	writeLeaderboard(&sb, batters)
+	return c.Reply(sb.String())
+}
+
+func writeLeaderboard(sb *strings.Builder, entries []LeaderboardEntry) {
+	for i, entry := range entries {
+		fmt.Fprintf(sb, "%d. <@%s> %d\n", i+1, entry.User, entry.Count)
+	}
+}
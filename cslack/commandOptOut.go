@@ -0,0 +1,58 @@
+package cslack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "optout",
+		Usage:   "stop anyone from batting you",
+		Handler: optOutCommand,
+	})
+	RegisterCommand(Command{
+		Name:    "optin",
+		Usage:   "let people bat you again",
+		Handler: optInCommand,
+	})
+	RegisterCommand(Command{
+		Name:    "optouts",
+		Usage:   "list everyone who has opted out of cluebats",
+		Role:    RoleAdmin,
+		Handler: optOutsCommand,
+	})
+}
+
+func optOutCommand(c *CommandContext) error {
+	if err := optOut(c.Server, c.Event.User); err != nil {
+		c.Reply("Sorry, I couldn't save that. Try again in a bit.")
+		return err
+	}
+	return c.Reply("ok, nobody can bat you now. `optin` if you change your mind")
+}
+
+func optInCommand(c *CommandContext) error {
+	if err := optIn(c.Server, c.Event.User); err != nil {
+		c.Reply("Sorry, I couldn't save that. Try again in a bit.")
+		return err
+	}
+	return c.Reply("ok, you're fair game again")
+}
+
+func optOutsCommand(c *CommandContext) error {
+	users, err := optedOutUsers(c.Server)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return c.Reply("nobody has opted out")
+	}
+	sort.Strings(users)
+	mentions := make([]string, 0, len(users))
+	for _, user := range users {
+		mentions = append(mentions, "<@"+user+">")
+	}
+	return c.Reply(fmt.Sprintf("opted out: %s", strings.Join(mentions, ", ")))
+}
@@ -0,0 +1,19 @@
+package cslack
+
+import "github.com/golang/glog"
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "ping",
+		Usage:   "check that cluebatbot is awake",
+		Handler: pingCommand,
+	})
+}
+
+func pingCommand(c *CommandContext) error {
+	if *debugCSlack {
+		user, _ := c.Server.directory().User(c.Event.User)
+		glog.Infof("%s someone named %s pinged me bro. Type: %s", c.Server.Name, user.Name, c.Event.Type)
+	}
+	return c.Reply("pong")
+}
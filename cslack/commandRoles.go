@@ -0,0 +1,117 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "grant",
+		Usage:   "give <user> a role: " + strings.Join(grantableRoles, ", "),
+		Args:    []ArgSpec{{Name: "user", Kind: ArgUser}, {Name: "role"}},
+		Role:    RoleOwner,
+		Handler: grantCommand,
+	})
+	RegisterCommand(Command{
+		Name:    "revoke",
+		Usage:   "take a role away from <user>",
+		Args:    []ArgSpec{{Name: "user", Kind: ArgUser}, {Name: "role"}},
+		Role:    RoleOwner,
+		Handler: revokeCommand,
+	})
+	RegisterCommand(Command{
+		Name:    "roles",
+		Usage:   "show the roles <user> has, or who holds each role",
+		Args:    []ArgSpec{{Name: "user", Kind: ArgUser, Optional: true}},
+		Handler: rolesCommand,
+	})
+}
+
+func grantCommand(c *CommandContext) error {
+	userID := c.Args[0].Value
+	role := strings.ToLower(c.Args[1].Value)
+	if !isGrantableRole(role) {
+		return c.Reply(fmt.Sprintf("`%s` isn't a role. Try one of: %s", role, strings.Join(grantableRoles, ", ")))
+	}
+	if role == bannedRole {
+		if c.Server.configOwner(userID) {
+			return c.Reply(fmt.Sprintf("<@%s> owns this server in the config file and can't be banned.", userID))
+		}
+		// chat granted owners can't ban each other, only a config owner can
+		targetRole, _, err := userRole(c.Server, userID)
+		if err != nil {
+			c.Reply("Sorry, I couldn't check their roles just now. Try again in a bit.")
+			return err
+		}
+		if targetRole == RoleOwner && !c.Server.configOwner(c.Event.User) {
+			return c.Reply(fmt.Sprintf("<@%s> is an owner. Only an owner from the config file can ban them.", userID))
+		}
+	}
+	if err := grantRole(c.Server, userID, role); err != nil {
+		c.Reply("Sorry, I couldn't save that. Try again in a bit.")
+		return err
+	}
+	return c.Reply(fmt.Sprintf("<@%s> is now %s", userID, role))
+}
+
+func revokeCommand(c *CommandContext) error {
+	userID := c.Args[0].Value
+	role := strings.ToLower(c.Args[1].Value)
+	if !isGrantableRole(role) {
+		return c.Reply(fmt.Sprintf("`%s` isn't a role. Try one of: %s", role, strings.Join(grantableRoles, ", ")))
+	}
+	if role == RoleOwner.String() && c.Server.configOwner(userID) {
+		return c.Reply(fmt.Sprintf("<@%s> owns this server in the config file. That can't be revoked from chat.", userID))
+	}
+	// demoting an owner would let them be banned next, so it takes a config owner too
+	if role == RoleOwner.String() && !c.Server.configOwner(c.Event.User) {
+		targetRole, _, err := userRole(c.Server, userID)
+		if err != nil {
+			c.Reply("Sorry, I couldn't check their roles just now. Try again in a bit.")
+			return err
+		}
+		if targetRole == RoleOwner {
+			return c.Reply(fmt.Sprintf("<@%s> is an owner. Only an owner from the config file can revoke that.", userID))
+		}
+	}
+	if err := revokeRole(c.Server, userID, role); err != nil {
+		c.Reply("Sorry, I couldn't save that. Try again in a bit.")
+		return err
+	}
+	return c.Reply(fmt.Sprintf("<@%s> is no longer %s", userID, role))
+}
+
+func rolesCommand(c *CommandContext) error {
+	if len(c.Args) > 0 {
+		userID := c.Args[0].Value
+		names, err := userRoleNames(c.Server, userID)
+		if err != nil {
+			return err
+		}
+		return c.Reply(fmt.Sprintf("<@%s> has %s", userID, formatRoleList(names)))
+	}
+	var sb strings.Builder
+	configOwners := make([]string, 0, len(c.Server.Owners))
+	for _, owner := range c.Server.Owners {
+		configOwners = append(configOwners, "<@"+owner+">")
+	}
+	fmt.Fprintf(&sb, "owner (config): %s\n", strings.Join(configOwners, ", "))
+	for _, role := range grantableRoles {
+		members, err := redis_wrapper.SMembers(roleKey(c.Server, role))
+		if err != nil {
+			return err
+		}
+		mentions := make([]string, 0, len(members))
+		for _, m := range members {
+			mentions = append(mentions, "<@"+m+">")
+		}
+		if len(mentions) == 0 {
+			mentions = append(mentions, "nobody")
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", role, strings.Join(mentions, ", "))
+	}
+	return c.Reply(sb.String())
+}
@@ -0,0 +1,239 @@
+package cslack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// CommandHandler runs a command. Errors returned are logged by the router
+type CommandHandler func(c *CommandContext) error
+
+// ArgSpec describes a single argument a command takes
+type ArgSpec struct {
+	Name string
+	// Kind the arg has to be. ArgAny takes whatever was typed
+	Kind     ArgKind
+	Optional bool
+	// Variadic args swallow everything left on the line. Only valid as the last arg
+	Variadic bool
+}
+
+// Command is a chat command registered with the router
+type Command struct {
+	Name    string
+	Aliases []string
+	// Usage is the one line description shown by help
+	Usage string
+	// Help is the longer text shown by `help <command>`. Optional
+	Help string
+	Args []ArgSpec
+	// Role is the lowest role allowed to run the command
+	Role    Role
+	Handler CommandHandler
+	// Hidden commands still run but are left out of help
+	Hidden bool
+	// DisabledByDefault commands only run on servers that turn them on in Features
+	DisabledByDefault bool
+}
+
+// replyFunc sends a command's response somewhere other than the channel it came from.
+// blocks may be nil
+type replyFunc func(msg string, blocks []slack.Block) error
+
+// CommandContext is everything a CommandHandler gets to work with
+type CommandContext struct {
+	Event    slack.MessageEvent
+	SlackAPI *slack.Client
+	Server   *SlackServer
+	Command  *Command
+	// Name is the name or alias the command was invoked with
+	Name string
+	Args []Arg
+	// reply overrides where Reply sends, e.g. ephemerally to a slash command. Optional
+	reply replyFunc
+}
+
+var (
+	commands    = make(map[string]*Command)
+	commandList []*Command
+)
+
+// RegisterCommand adds a command to the router. Commands register themselves from init()
+// in their own file. Registering a name or alias twice panics
+func RegisterCommand(cmd Command) {
+	if cmd.Name == "" || cmd.Handler == nil {
+		panic("cslack: commands need a name and a handler")
+	}
+	for i, arg := range cmd.Args {
+		if arg.Variadic && i != len(cmd.Args)-1 {
+			panic(fmt.Sprintf("cslack: command %q has a variadic arg that is not last", cmd.Name))
+		}
+	}
+	c := &cmd
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		key := strings.ToLower(name)
+		if _, exists := commands[key]; exists {
+			panic(fmt.Sprintf("cslack: command %q registered twice", key))
+		}
+		commands[key] = c
+	}
+	commandList = append(commandList, c)
+	sort.Slice(commandList, func(i, j int) bool { return commandList[i].Name < commandList[j].Name })
+}
+
+// LookupCommand finds a command by name or alias
+func LookupCommand(name string) (*Command, bool) {
+	cmd, ok := commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Signature renders the command and its args, e.g. `bat <user> [message...]`
+func (cmd *Command) Signature() string {
+	parts := []string{cmd.Name}
+	for _, arg := range cmd.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Enabled reports whether the command is turned on for a server. The server's Features
+// map wins, otherwise the command's default applies
+func (cmd *Command) Enabled(server *SlackServer) bool {
+	if enabled, ok := server.Features[cmd.Name]; ok {
+		return enabled
+	}
+	return !cmd.DisabledByDefault
+}
+
+func (cmd *Command) requiredArgs() int {
+	required := 0
+	for _, arg := range cmd.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+	return required
+}
+
+// Rest renders the args from index i on back into text
+func (c *CommandContext) Rest(i int) string {
+	if i >= len(c.Args) {
+		return ""
+	}
+	return Text(c.Args[i:])
+}
+
+// checkArgs makes sure there are enough args and that they are the right kind
+func (cmd *Command) checkArgs(args []Arg) error {
+	if len(args) < cmd.requiredArgs() {
+		return fmt.Errorf("usage: `%s`", cmd.Signature())
+	}
+	for i, spec := range cmd.Args {
+		if spec.Kind == ArgAny {
+			continue
+		}
+		end := i + 1
+		if spec.Variadic {
+			end = len(args)
+		}
+		for j := i; j < end && j < len(args); j++ {
+			if args[j].Kind != spec.Kind {
+				return fmt.Errorf("`%s` should be a %s. usage: `%s`", spec.Name, spec.Kind, cmd.Signature())
+			}
+		}
+	}
+	return nil
+}
+
+// Reply sends msg back to the channel the command came from, or privately to the sender
+// when it came from a slash command
+func (c *CommandContext) Reply(msg string) error {
+	return c.ReplyBlocks(msg)
+}
+
+// ReplyBlocks is Reply with Block Kit blocks. msg is still needed as the fallback text
+func (c *CommandContext) ReplyBlocks(msg string, blocks ...slack.Block) error {
+	if c.reply != nil {
+		return c.reply(msg, blocks)
+	}
+	_, _, err := sendSlackMessage(c.Event, msg, c.Event.Channel, *c.SlackAPI, c.Server, blocks...)
+	return err
+}
+
+// routeCommand finds the command for a message and runs it. Returns false if the
+// message wasn't a command we know. reply is optional, see CommandContext.Reply
+func routeCommand(ev slack.MessageEvent, slackAPI *slack.Client, server *SlackServer, reply replyFunc) bool {
+	args, parseErr := Tokenize(ev.Msg.Text)
+	if len(args) == 0 || args[0].Kind != ArgText {
+		return false
+	}
+	cmd, ok := LookupCommand(args[0].Value)
+	if !ok {
+		if *debugCSlack {
+			glog.Infof("%s ignoring: %s", server.Name, ev.Msg.Text)
+		}
+		return false
+	}
+	c := &CommandContext{
+		Event:    ev,
+		SlackAPI: slackAPI,
+		Server:   server,
+		Command:  cmd,
+		Name:     args[0].Value,
+		Args:     args[1:],
+		reply:    reply,
+	}
+	if !cmd.Enabled(server) {
+		if *debugCSlack {
+			glog.Infof("%s %s is disabled, ignoring it from %s", server.Name, cmd.Name, ev.User)
+		}
+		if !cmd.Hidden {
+			if err := c.Reply(fmt.Sprintf("`%s` is turned off on this server", cmd.Name)); err != nil {
+				glog.Errorf("%s error saying %s is disabled in %s: %s", server.Name, cmd.Name, ev.Channel, err)
+			}
+		}
+		countCommand(server, cmd, outcomeDisabled)
+		return true
+	}
+	allowed, why, err := authorize(server, ev.User, cmd)
+	if err != nil {
+		glog.Errorf("%s error checking roles of %s for %s: %s", server.Name, ev.User, cmd.Name, err)
+	}
+	if !allowed {
+		if err := c.Reply(why); err != nil {
+			glog.Errorf("%s error telling %s they can't run %s: %s", server.Name, ev.User, cmd.Name, err)
+		}
+		countCommand(server, cmd, outcomeDenied)
+		return true
+	}
+	argErr := parseErr
+	if argErr == nil {
+		argErr = cmd.checkArgs(c.Args)
+	}
+	if argErr != nil {
+		if err := c.Reply(fmt.Sprintf("couldn't make sense of that: %s", argErr)); err != nil {
+			glog.Errorf("%s error sending usage for %s in %s: %s", server.Name, cmd.Name, ev.Channel, err)
+		}
+		countCommand(server, cmd, outcomeBadArgs)
+		return true
+	}
+	if err := cmd.Handler(c); err != nil {
+		glog.Errorf("%s command %s from %s failed: %s", server.Name, cmd.Name, ev.User, err)
+		countCommand(server, cmd, outcomeError)
+		return true
+	}
+	countCommand(server, cmd, outcomeOK)
+	return true
+}
@@ -0,0 +1,54 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:    "pending",
+		Usage:   "list your scheduled cluebats",
+		Role:    RoleBatter,
+		Handler: pendingCommand,
+	})
+	RegisterCommand(Command{
+		Name:    "cancel",
+		Usage:   "call off one of your scheduled cluebats",
+		Args:    []ArgSpec{{Name: "id"}},
+		Role:    RoleBatter,
+		Handler: cancelCommand,
+	})
+}
+
+func pendingCommand(c *CommandContext) error {
+	jobs, err := pendingBats(c.Server, c.Event.User)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return c.Reply("you have no cluebats waiting")
+	}
+	var sb strings.Builder
+	sb.WriteString("your waiting cluebats:\n")
+	for _, job := range jobs {
+		fmt.Fprintf(&sb, "`%s` <@%s> %s", job.ID, job.Request.Target, slackDate(job.Due))
+		if job.Request.Tag != "" {
+			fmt.Fprintf(&sb, " (%s)", job.Request.Tag)
+		}
+		sb.WriteString("\n")
+	}
+	return c.Reply(sb.String())
+}
+
+func cancelCommand(c *CommandContext) error {
+	id := c.Args[0].Value
+	cancelled, err := cancelBat(c.Server, c.Event.User, id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return c.Reply(fmt.Sprintf("you don't have a cluebat `%s` waiting", id))
+	}
+	return c.Reply(fmt.Sprintf("cluebat `%s` called off", id))
+}
@@ -0,0 +1,135 @@
+package cslack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:  "template",
+		Usage: "manage cluebat messages: `add`, `list`, `remove <id>` or `preview <id>`",
+		Help: "`template add [weight=N] [tags=gentle,savage] \"WHAM. {{.Target}}!\"` adds a message. " +
+			"Templates can use {{.Target}}, {{.Sender}}, {{.Channel}} and {{.Count}}.\n" +
+			"`template list [tag]` shows them, `template remove <id>` deletes one and " +
+			"`template preview <id>` shows what it would look like.\n" +
+			"`bat @user <tag>` only picks from templates with that tag.",
+		Aliases: []string{"templates"},
+		Args:    []ArgSpec{{Name: "action"}, {Name: "args", Optional: true, Variadic: true}},
+		Role:    RoleAdmin,
+		Handler: templateCommand,
+	})
+}
+
+func templateCommand(c *CommandContext) error {
+	switch strings.ToLower(c.Args[0].Value) {
+	case "add":
+		return templateAdd(c)
+	case "list", "ls":
+		return templateList(c)
+	case "remove", "rm", "delete":
+		return templateRemove(c)
+	case "preview":
+		return templatePreview(c)
+	default:
+		return c.Reply(commandHelpText(c.Command))
+	}
+}
+
+func templateAdd(c *CommandContext) error {
+	var t BatTemplate
+	args := c.Args[1:]
+	for len(args) > 0 && args[0].Kind == ArgText && !args[0].Quoted {
+		if weight := strings.TrimPrefix(args[0].Value, "weight="); weight != args[0].Value {
+			w, err := strconv.Atoi(weight)
+			if err != nil || w < 1 {
+				return c.Reply(fmt.Sprintf("weight should be a whole number above 0, not `%s`", weight))
+			}
+			t.Weight = w
+		} else if tags := strings.TrimPrefix(args[0].Value, "tags="); tags != args[0].Value {
+			for _, tag := range strings.Split(tags, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					t.Tags = append(t.Tags, strings.ToLower(tag))
+				}
+			}
+		} else {
+			break
+		}
+		args = args[1:]
+	}
+	t.Text = Text(args)
+	if t.Text == "" {
+		return c.Reply("usage: `template add [weight=N] [tags=a,b] \"message text\"`")
+	}
+	t, err := addTemplate(c.Server, t)
+	if err != nil {
+		return c.Reply(fmt.Sprintf("couldn't add that: %s", err))
+	}
+	return c.Reply(fmt.Sprintf("added template `%s`", t.ID))
+}
+
+func templateList(c *CommandContext) error {
+	tag := c.Rest(1)
+	templates, builtin, err := loadTemplates(c.Server)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if builtin {
+		sb.WriteString("no templates of our own yet, using the built-ins:\n")
+	}
+	for _, t := range templates {
+		if tag != "" && !t.HasTag(tag) {
+			continue
+		}
+		fmt.Fprintf(&sb, "`%s` weight %d", t.ID, t.weight())
+		if len(t.Tags) > 0 {
+			fmt.Fprintf(&sb, " tags %s", strings.Join(t.Tags, ","))
+		}
+		fmt.Fprintf(&sb, ": %s\n", t.Text)
+	}
+	return c.Reply(sb.String())
+}
+
+func templateRemove(c *CommandContext) error {
+	if len(c.Args) < 2 {
+		return c.Reply("usage: `template remove <id>`")
+	}
+	id := c.Args[1].Value
+	removed, err := removeTemplate(c.Server, id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return c.Reply(fmt.Sprintf("there's no template `%s`", id))
+	}
+	return c.Reply(fmt.Sprintf("removed template `%s`", id))
+}
+
+func templatePreview(c *CommandContext) error {
+	if len(c.Args) < 2 {
+		return c.Reply("usage: `template preview <id>`")
+	}
+	id := c.Args[1].Value
+	templates, _, err := loadTemplates(c.Server)
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		if t.ID != id {
+			continue
+		}
+		msg, err := t.Render(BatTemplateData{
+			Target:  "<@" + c.Event.User + ">",
+			Sender:  "<@" + c.Event.User + ">",
+			Channel: "<#" + c.Event.Channel + ">",
+			Count:   1,
+		})
+		if err != nil {
+			return c.Reply(fmt.Sprintf("`%s` doesn't render: %s", id, err))
+		}
+		return c.Reply(msg)
+	}
+	return c.Reply(fmt.Sprintf("there's no template `%s`", id))
+}
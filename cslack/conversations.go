@@ -0,0 +1,172 @@
+package cslack
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+const (
+	conversationPageSize         = 200
+	maxRateLimitRetries          = 5
+	defaultConversationCacheTime = 10 * time.Minute
+	// lookupMaxWait caps how long a lookup made for a command waits out rate limits. Those
+	// run on the event loop, so everything else waits with them
+	lookupMaxWait = 3 * time.Second
+	// syncMaxWait caps the directory sync, which runs on its own before and beside the loop
+	syncMaxWait = 2 * time.Minute
+)
+
+// ConversationIterator walks every page of the conversations a user is in, following
+// slack's cursor and waiting out rate limits. Use it like a bufio.Scanner:
+//
+//	it := NewConversationIterator(api, server, userID)
+//	for it.Next() {
+//		channel := it.Channel()
+//	}
+//	if err := it.Err(); err != nil {
+type ConversationIterator struct {
+	slackAPI *slack.Client
+	server   *SlackServer
+	params   slack.GetConversationsForUserParameters
+	page     []slack.Channel
+	index    int
+	current  slack.Channel
+	lastPage bool
+	maxWait  time.Duration
+	err      error
+}
+
+// NewConversationIterator lists the public and private channels userID is in
+func NewConversationIterator(slackAPI *slack.Client, server *SlackServer, userID string) *ConversationIterator {
+	return &ConversationIterator{
+		slackAPI: slackAPI,
+		server:   server,
+		params: slack.GetConversationsForUserParameters{
+			UserID:          userID,
+			Types:           []string{"public_channel", "private_channel"},
+			Limit:           conversationPageSize,
+			ExcludeArchived: true,
+		},
+		maxWait: lookupMaxWait,
+	}
+}
+
+// Next moves to the next conversation, fetching another page when needed. It returns
+// false when there are no more or an error stopped it
+func (it *ConversationIterator) Next() bool {
+	for it.index >= len(it.page) {
+		if it.lastPage || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.current = it.page[it.index]
+	it.index++
+	return true
+}
+
+// Channel is the conversation Next moved to
+func (it *ConversationIterator) Channel() slack.Channel {
+	return it.current
+}
+
+// Err is the error that stopped the iterator, if any
+func (it *ConversationIterator) Err() error {
+	return it.err
+}
+
+func (it *ConversationIterator) fetch() {
+	var channels []slack.Channel
+	var cursor string
+	err := waitOutRateLimit(it.server, "users.conversations", it.maxWait, func() error {
+		var err error
+		channels, cursor, err = it.slackAPI.GetConversationsForUser(&it.params)
+		return err
+	})
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.page = channels
+	it.index = 0
+	it.params.Cursor = cursor
+	it.lastPage = cursor == ""
+}
+
+// waitOutRateLimit runs call, waiting and trying again while slack rate limits it, for no
+// more than maxWait in all. If that isn't long enough it gives up with the
+// *slack.RateLimitedError, whose RetryAfter says when to try again. method is the API
+// method, for the logs and the slack errors metric
+func waitOutRateLimit(server *SlackServer, method string, maxWait time.Duration, call func() error) error {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if rateLimited, ok := err.(*slack.RateLimitedError); ok && attempt < maxRateLimitRetries {
+			wait := rateLimited.RetryAfter
+			if wait <= 0 {
+				wait = time.Duration(1<<uint(attempt)) * time.Second
+			}
+			if waited+wait <= maxWait {
+				glog.Infof("%s rate limited calling %s, waiting %s", server.Name, method, wait)
+				time.Sleep(wait)
+				waited += wait
+				continue
+			}
+			glog.Infof("%s rate limited calling %s for %s, not waiting that long", server.Name, method, wait)
+			rateLimited.RetryAfter = wait
+		}
+		if err != nil {
+			countSlackError(server, method)
+		}
+		return err
+	}
+}
+
+func conversationCacheKey(server *SlackServer, userID string) string {
+	return server.Name + ":conversations:" + userID
+}
+
+// getUserConversations lists every conversation userID is in. Results are kept in redis
+// for the server's ConversationCacheSeconds so repeat bats don't walk every page again
+func getUserConversations(slackAPI *slack.Client, server *SlackServer, userID string) ([]slack.Channel, error) {
+	key := conversationCacheKey(server, userID)
+	var channels []slack.Channel
+	// a miss comes back as an error too, so just fall through to slack on any error
+	if data, err := redis_wrapper.Get(key); err == nil {
+		err = json.Unmarshal(data, &channels)
+		if err == nil {
+			if *debugCSlack {
+				glog.Infof("%s using %d cached conversations for %s", server.Name, len(channels), userID)
+			}
+			return channels, nil
+		}
+		glog.Errorf("%s bad cached conversations for %s, refetching: %s", server.Name, userID, err)
+		channels = nil
+	}
+
+	it := NewConversationIterator(slackAPI, server, userID)
+	for it.Next() {
+		channels = append(channels, it.Channel())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	ttl := defaultConversationCacheTime
+	if server.ConversationCacheSeconds > 0 {
+		ttl = time.Duration(server.ConversationCacheSeconds) * time.Second
+	}
+	data, err := json.Marshal(channels)
+	if err != nil {
+		glog.Errorf("%s error encoding conversations for %s: %s", server.Name, userID, err)
+		return channels, nil
+	}
+	if err := redis_wrapper.SetEx(key, data, ttl); err != nil {
+		glog.Errorf("%s error caching conversations for %s: %s", server.Name, userID, err)
+	}
+	return channels, nil
+}
@@ -0,0 +1,39 @@
+package cslack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+func TestWaitOutRateLimit(t *testing.T) {
+	server := testServer("limited", "BOT1", "TEAM1")
+
+	calls := 0
+	err := waitOutRateLimit(server, "test.short", time.Second, func() error {
+		calls++
+		if calls == 1 {
+			return &slack.RateLimitedError{RetryAfter: time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("short limit: err %v after %d calls, want nil after 2", err, calls)
+	}
+
+	// a wait past the cap comes straight back instead of blocking the caller
+	calls = 0
+	start := time.Now()
+	err = waitOutRateLimit(server, "test.long", time.Second, func() error {
+		calls++
+		return &slack.RateLimitedError{RetryAfter: time.Minute}
+	})
+	rateLimited, ok := err.(*slack.RateLimitedError)
+	if !ok || rateLimited.RetryAfter != time.Minute {
+		t.Fatalf("long limit: err %v, want a rate limit error to retry in a minute", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("long limit: %d calls in %s, want 1 without waiting", calls, time.Since(start))
+	}
+}
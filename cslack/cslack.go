@@ -2,7 +2,7 @@ package cslack
 
 import (
 	"flag"
-	"os"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/nlopes/slack"
@@ -13,75 +13,131 @@ type SlackServer struct {
 	Name           string `json:"Name"`
 	APIKey         string `json:"APIKey"`
 	CluebatBotChan string `json:"CluebatBotChan"`
-	OwnerID        string `json:"OwnerID"`
-	LatencyCounter int
-	LatencySlice   []int64
-	Channels       map[string]slack.Channel
-	Users          map[string]slack.User
+	// Owners always hold the owner role, and get DMed when there's no CluebatBotChan
+	Owners []string `json:"Owners"`
+	// CommandPrefix lets people talk to the bot in channels without an @mention, e.g. "!cb"
+	CommandPrefix string `json:"CommandPrefix"`
+	// Features turns commands on or off by name, e.g. {"bat": true, "die": false}. Commands
+	// not listed use their own default
+	Features map[string]bool `json:"Features"`
+	// ConversationCacheSeconds is how long a bat target's channel list is cached. Default 600
+	ConversationCacheSeconds int `json:"ConversationCacheSeconds"`
+	// ChannelPolicy decides which of the target's channels a bat can land in
+	ChannelPolicy ChannelPolicy `json:"ChannelPolicy"`
+	// RateLimits caps how many bats a sender, target and channel get. Unset uses the defaults
+	RateLimits RateLimits `json:"RateLimits"`
+	// Transport is "rtm" (the default), "http" for the Events API or "socket" for socket mode
+	Transport string `json:"Transport"`
+	// SigningSecret verifies requests slack sends over HTTP
+	SigningSecret string `json:"SigningSecret"`
+	// AppToken is the xapp- app level token socket mode connects with
+	AppToken string `json:"AppToken"`
+	// SlackAPIURL points the bot at another slack API, like sockettest's fake. Optional
+	SlackAPIURL string `json:"SlackAPIURL"`
+	// DirectoryRefreshSeconds is how often the user and channel directory is synced in
+	// full. Events keep it current in between. Default 3600
+	DirectoryRefreshSeconds int `json:"DirectoryRefreshSeconds"`
+	// LatencyWindow is how many RTM latency samples the live stats cover. Default 60
+	LatencyWindow int `json:"LatencyWindow"`
+	// LatencyRetentionHours is how long latency history is kept in redis. Default 168
+	LatencyRetentionHours int `json:"LatencyRetentionHours"`
+	// LatencyAlerts tell the owners when latency stays high. Unset alerts after 5 reports
+	// over 2s
+	LatencyAlerts []LatencyAlert `json:"LatencyAlerts"`
+
+	state *serverState
 }
 
+// The debug flags can also be turned on from the config file's Logging section
 var (
 	debugCSlack      = flag.Bool("debugCSlack", false, "enable or disable debug in cslack")
 	debugLatencyTick = flag.Bool("debugLatencyTick", false, "tick every time a latency message is processed. Talkative")
-	botID            string
 )
 
-// SlackServerManager is the entry point to the cslack lib
+// SlackServerManager is the entry point to the cslack lib. Each server gets its own
+// goroutine and its own state, so any number can run side by side
 func SlackServerManager(slackAPI *slack.Client, server SlackServer, myID string, myTeamID string) {
-	debugText := os.Getenv("CSLACK_DEBUG")
-	if debugText == "true" {
-		glog.Infof("init %s cslack debug on", server.Name)
-		*debugCSlack = true
-	}
-	debugLTick := os.Getenv("CSLACK_DEBUG_LATENCY_TICK")
-	if debugLTick == "true" {
-		*debugLatencyTick = true
+	server.state = newServerState(&server, myID, myTeamID)
+	server.state.conn.set(connStarting)
+	trackServer(&server)
+	transport, err := newTransport(slackAPI, &server)
+	if err != nil {
+		glog.Errorf("%s can't start: %s", server.Name, err)
+		server.state.conn.set(connDown)
+		return
 	}
 
-	botID = myID
-	rtm := slackAPI.NewRTM()
-	go rtm.ManageConnection()
-
-	// init maps
-	server.Users = make(map[string]slack.User)
-	server.Channels = make(map[string]slack.Channel)
+	// start from the cache so lookups work even if slack is slow, then get the real thing
+	server.directory().dropLegacyKeys()
+	dropLegacyLatencyKeys(&server)
+	server.directory().loadCache()
+	server.directory().sync(slackAPI)
+	refresh := defaultDirectoryRefresh
+	if server.DirectoryRefreshSeconds > 0 {
+		refresh = time.Duration(server.DirectoryRefreshSeconds) * time.Second
+	}
+	go server.directory().run(slackAPI, refresh)
 
-	// store all the channels and users on startup
-	getSlackUsers(slackAPI, &server)
-	getSlackChannels(slackAPI, &server)
+	go runScheduler(slackAPI, &server)
+	if server.SigningSecret != "" {
+		registerSlashCommands(slackAPI, &server)
+		registerInteractivity(slackAPI, &server)
+	}
 
+	if err := transport.Start(); err != nil {
+		glog.Errorf("%s can't connect: %s", server.Name, err)
+		server.state.conn.set(connDown)
+		return
+	}
 	// stack of messages for the win...
-	for msg := range rtm.IncomingEvents {
-		handleSlackEvents(msg, *rtm, *slackAPI, &server)
+	for msg := range transport.Events() {
+		handleSlackEvents(msg, slackAPI, &server, transport.Shared())
 		glog.Flush()
 	}
 }
 
-func handleSlackEvents(msg slack.RTMEvent, rtm slack.RTM, slackAPI slack.Client, server *SlackServer) {
+// handleSlackEvents acts on one event. shared means the other replicas got it too
+func handleSlackEvents(msg slack.RTMEvent, slackAPI *slack.Client, server *SlackServer, shared bool) {
+	eventsCounter.WithLabelValues(server.Name, msg.Type).Inc()
+	if server.directory().applyEvent(msg.Data) {
+		return
+	}
 	switch ev := msg.Data.(type) {
 	case *slack.HelloEvent:
 		// Ignore hello
 	case *slack.ConnectedEvent:
-		botID = ev.Info.User.ID
-		rtm.SendMessage(rtm.NewOutgoingMessage("ClueBatBot Connected!", server.CluebatBotChan))
+		server.state.setIdentity(ev.Info.User.ID, ev.Info.Team.ID)
+		server.state.conn.set(connConnected)
+		if isLeader() {
+			sendSlackMessage(slack.MessageEvent{}, "ClueBatBot Connected!", server.CluebatBotChan, *slackAPI, server)
+		}
 	case *slack.MessageEvent:
-		if ev.User != botID {
-			HandleSlackMessageEvent(*ev, rtm, slackAPI, server)
+		// standbys keep their connection warm but leave the talking to the leader
+		if ev.User != server.botID() && (!shared || isLeader()) && firstDelivery(server, ev.Team, ev.Channel, ev.Timestamp) {
+			HandleSlackMessageEvent(*ev, slackAPI, server)
 		}
+	case *slack.DisconnectedEvent:
+		server.state.conn.set(connDown)
+	case *slashCommandEvent:
+		responseURL := ev.Command.ResponseURL
+		runSlashCommand(ev.Command, slackAPI, server, func(msg string, blocks []slack.Block) error {
+			return postToResponseURL(responseURL, msg, blocks)
+		})
+	case *interactionEvent:
+		handleInteraction(ev.Callback, slackAPI, server)
 	case *slack.PresenceChangeEvent:
 		// Ignoring PresenceChangeEvent
 	case *slack.LatencyReport:
-		handleLatency(ev.Value, server)
+		handleLatency(ev.Value, slackAPI, server)
 	case *slack.RTMError:
 		if *debugCSlack {
 			glog.Infof("%s got slack RTM Error: %v\n", server.Name, ev)
 		}
 	case *slack.InvalidAuthEvent:
+		server.state.conn.set(connInvalidAuth)
 		if *debugCSlack {
 			glog.Fatalf("%s failed due to invalid credentials. It is likely that this api key is bad.", server.Name)
 		}
-	case *slack.UserChangeEvent:
-		// Ignoring UserChangeEvents
 	default:
 		// Ignore other events..
 		if *debugCSlack {
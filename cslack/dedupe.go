@@ -0,0 +1,39 @@
+package cslack
+
+import (
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+)
+
+// seenTTL is how long a message is remembered. Redeliveries come within seconds, this
+// just has to comfortably outlast an RTM reconnect or a leader change
+const seenTTL = 10 * time.Minute
+
+// firstDelivery claims a message by (team, channel, ts) and reports whether this is the
+// first time anyone in the deployment has seen it. If redis is down the message is let
+// through, since a rare double reply beats a bot that ignores everyone
+func firstDelivery(server *SlackServer, team string, channel string, ts string) bool {
+	if team == "" {
+		team = server.teamID()
+	}
+	key := server.Name + ":seen:" + team + ":" + channel + ":" + ts
+	first, err := redis_wrapper.SetNX(key, []byte(nodeID()), seenTTL)
+	if err != nil {
+		glog.Errorf("%s error deduplicating %s, handling it anyway: %s", server.Name, key, err)
+		return true
+	}
+	if !first && *debugCSlack {
+		glog.Infof("%s already handled %s, skipping it", server.Name, key)
+	}
+	return first
+}
+
+// nodeID names this replica in redis bookkeeping
+func nodeID() string {
+	if elector != nil {
+		return elector.id
+	}
+	return "local"
+}
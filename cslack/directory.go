@@ -0,0 +1,324 @@
+package cslack
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+const defaultDirectoryRefresh = time.Hour
+
+// Directory is a server's users and channels. Commands read it from memory. Redis keeps a
+// json copy so a restart has names to work with before the first sync finishes
+type Directory struct {
+	server *SlackServer
+
+	mu       sync.RWMutex
+	users    map[string]slack.User
+	channels map[string]slack.Channel
+	// while a sync is fetching, these note the ids events changed. Those are newer than the
+	// snapshot the sync brings back, so it leaves them alone. Nil when no sync is running
+	touchedUsers    map[string]bool
+	touchedChannels map[string]bool
+}
+
+// The directory is two hashes per server, id to json
+func directoryUsersKey(server *SlackServer) string {
+	return server.Name + ":directory:users"
+}
+
+func directoryChannelsKey(server *SlackServer) string {
+	return server.Name + ":directory:channels"
+}
+
+func newDirectory(server *SlackServer) *Directory {
+	return &Directory{
+		server:   server,
+		users:    make(map[string]slack.User),
+		channels: make(map[string]slack.Channel),
+	}
+}
+
+// User looks a user up by id
+func (d *Directory) User(id string) (slack.User, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	user, ok := d.users[id]
+	return user, ok
+}
+
+// UserByName looks a user up by their @name
+func (d *Directory) UserByName(name string) (slack.User, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, user := range d.users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return slack.User{}, false
+}
+
+// Channel looks a channel up by id
+func (d *Directory) Channel(id string) (slack.Channel, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	channel, ok := d.channels[id]
+	return channel, ok
+}
+
+// loadCache fills the directory from redis
+func (d *Directory) loadCache() {
+	users, err := redis_wrapper.HGetAll(directoryUsersKey(d.server))
+	if err != nil {
+		glog.Errorf("%s error loading cached users: %s", d.server.Name, err)
+	}
+	channels, err := redis_wrapper.HGetAll(directoryChannelsKey(d.server))
+	if err != nil {
+		glog.Errorf("%s error loading cached channels: %s", d.server.Name, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, data := range users {
+		var user slack.User
+		if err := json.Unmarshal([]byte(data), &user); err != nil {
+			continue
+		}
+		d.users[id] = user
+	}
+	for id, data := range channels {
+		var channel slack.Channel
+		if err := json.Unmarshal([]byte(data), &channel); err != nil {
+			continue
+		}
+		d.channels[id] = channel
+	}
+	glog.Infof("%s loaded %d users and %d channels from the cache", d.server.Name, len(d.users), len(d.channels))
+}
+
+// sync brings the directory up to date with what slack has now. Anyone slack no longer
+// knows about is dropped from memory and redis. Only one sync runs at a time, from the
+// server manager and then run
+func (d *Directory) sync(slackAPI *slack.Client) {
+	d.mu.Lock()
+	d.touchedUsers = make(map[string]bool)
+	d.touchedChannels = make(map[string]bool)
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.touchedUsers = nil
+		d.touchedChannels = nil
+		d.mu.Unlock()
+	}()
+
+	users, err := slackAPI.GetUsers()
+	if err != nil {
+		glog.Errorf("%s error syncing users: %s", d.server.Name, err)
+		countSlackError(d.server, "users.list")
+	} else {
+		d.mergeUsers(users)
+		glog.Infof("%s synced %d users", d.server.Name, len(users))
+	}
+
+	channels, err := d.listChannels(slackAPI)
+	if err != nil {
+		glog.Errorf("%s error syncing channels: %s", d.server.Name, err)
+		return
+	}
+	d.mergeChannels(channels)
+	glog.Infof("%s synced %d channels", d.server.Name, len(channels))
+}
+
+// mergeUsers applies a users.list snapshot, skipping users events changed mid-sync
+func (d *Directory) mergeUsers(users []slack.User) {
+	fresh := make(map[string]bool, len(users))
+	var changed []slack.User
+	var gone []string
+	d.mu.Lock()
+	for _, user := range users {
+		fresh[user.ID] = true
+		if !d.touchedUsers[user.ID] {
+			d.users[user.ID] = user
+			changed = append(changed, user)
+		}
+	}
+	for id := range d.users {
+		if !fresh[id] && !d.touchedUsers[id] {
+			delete(d.users, id)
+			gone = append(gone, id)
+		}
+	}
+	d.mu.Unlock()
+	for _, user := range changed {
+		d.cache(directoryUsersKey(d.server), user.ID, user)
+	}
+	d.uncache(directoryUsersKey(d.server), gone)
+}
+
+// mergeChannels applies a conversations.list snapshot, skipping channels events changed
+// mid-sync
+func (d *Directory) mergeChannels(channels []slack.Channel) {
+	fresh := make(map[string]bool, len(channels))
+	var changed []slack.Channel
+	var gone []string
+	d.mu.Lock()
+	for _, channel := range channels {
+		fresh[channel.ID] = true
+		if !d.touchedChannels[channel.ID] {
+			d.channels[channel.ID] = channel
+			changed = append(changed, channel)
+		}
+	}
+	for id := range d.channels {
+		if !fresh[id] && !d.touchedChannels[id] {
+			delete(d.channels, id)
+			gone = append(gone, id)
+		}
+	}
+	d.mu.Unlock()
+	for _, channel := range changed {
+		d.cache(directoryChannelsKey(d.server), channel.ID, channel)
+	}
+	d.uncache(directoryChannelsKey(d.server), gone)
+}
+
+// listChannels pages through every public and private channel the bot can see, archived
+// ones included so their state stays right
+func (d *Directory) listChannels(slackAPI *slack.Client) ([]slack.Channel, error) {
+	params := slack.GetConversationsParameters{
+		Types: []string{"public_channel", "private_channel"},
+		Limit: conversationPageSize,
+	}
+	var channels []slack.Channel
+	for {
+		var page []slack.Channel
+		var cursor string
+		err := waitOutRateLimit(d.server, "conversations.list", syncMaxWait, func() error {
+			var err error
+			page, cursor, err = slackAPI.GetConversations(&params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, page...)
+		if cursor == "" {
+			return channels, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// dropLegacyKeys deletes the <server>:user:<id> and <server>:channel:<id> blobs the bot
+// wrote before it had a directory. Nothing reads them any more. Once they're gone the scan
+// finds nothing, so it's cheap to run every start
+func (d *Directory) dropLegacyKeys() {
+	dropKeysMatching(d.server, d.server.Name+":user:*", d.server.Name+":channel:*")
+}
+
+// dropKeysMatching deletes every key matching the redis glob patterns
+func dropKeysMatching(server *SlackServer, patterns ...string) {
+	for _, pattern := range patterns {
+		keys, err := redis_wrapper.GetKeys(pattern)
+		if err != nil {
+			glog.Errorf("%s error finding old %s keys: %s", server.Name, pattern, err)
+			continue
+		}
+		for _, key := range keys {
+			if err := redis_wrapper.Delete(key); err != nil {
+				glog.Errorf("%s error deleting old key %s: %s", server.Name, key, err)
+			}
+		}
+		if len(keys) > 0 {
+			glog.Infof("%s deleted %d old %s keys", server.Name, len(keys), pattern)
+		}
+	}
+}
+
+// run syncs every interval for the life of the server manager
+func (d *Directory) run(slackAPI *slack.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.sync(slackAPI)
+	}
+}
+
+func (d *Directory) cache(key string, id string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		glog.Errorf("%s error encoding %s for the directory: %s", d.server.Name, id, err)
+		return
+	}
+	if err := redis_wrapper.HSet(key, id, data); err != nil {
+		glog.Errorf("%s error caching %s: %s", d.server.Name, id, err)
+	}
+}
+
+func (d *Directory) uncache(key string, ids []string) {
+	for _, id := range ids {
+		if _, err := redis_wrapper.HDel(key, id); err != nil {
+			glog.Errorf("%s error uncaching %s: %s", d.server.Name, id, err)
+		}
+	}
+}
+
+func (d *Directory) putUser(user slack.User) {
+	d.mu.Lock()
+	d.users[user.ID] = user
+	if d.touchedUsers != nil {
+		d.touchedUsers[user.ID] = true
+	}
+	d.mu.Unlock()
+	d.cache(directoryUsersKey(d.server), user.ID, user)
+}
+
+// updateChannel changes a channel we know about, or starts from a bare one with just the id
+func (d *Directory) updateChannel(id string, change func(*slack.Channel)) {
+	d.mu.Lock()
+	channel, ok := d.channels[id]
+	if !ok {
+		channel.ID = id
+	}
+	change(&channel)
+	d.channels[id] = channel
+	if d.touchedChannels != nil {
+		d.touchedChannels[id] = true
+	}
+	d.mu.Unlock()
+	d.cache(directoryChannelsKey(d.server), id, channel)
+}
+
+// applyEvent keeps the directory current between syncs. False means ev wasn't a
+// directory event
+func (d *Directory) applyEvent(ev interface{}) bool {
+	switch ev := ev.(type) {
+	case *slack.UserChangeEvent:
+		d.putUser(ev.User)
+	case *slack.TeamJoinEvent:
+		d.putUser(ev.User)
+	case *slack.ChannelCreatedEvent:
+		d.updateChannel(ev.Channel.ID, func(c *slack.Channel) {
+			c.Name = ev.Channel.Name
+			c.IsChannel = ev.Channel.IsChannel
+			c.Creator = ev.Channel.Creator
+			c.Created = slack.JSONTime(ev.Channel.Created)
+		})
+	case *slack.ChannelRenameEvent:
+		d.updateChannel(ev.Channel.ID, func(c *slack.Channel) { c.Name = ev.Channel.Name })
+	case *slack.ChannelArchiveEvent:
+		d.updateChannel(ev.Channel, func(c *slack.Channel) { c.IsArchived = true })
+	case *slack.ChannelUnarchiveEvent:
+		d.updateChannel(ev.Channel, func(c *slack.Channel) { c.IsArchived = false })
+	default:
+		return false
+	}
+	if *debugCSlack {
+		glog.Infof("%s directory applied %T", d.server.Name, ev)
+	}
+	return true
+}
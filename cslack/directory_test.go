@@ -0,0 +1,88 @@
+package cslack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// TestDirectorySyncKeepsEventsFromMidSync has slack answer users.list and
+// conversations.list with snapshots taken before some events, and delivers those events
+// while the pages are loading
+func TestDirectorySyncKeepsEventsFromMidSync(t *testing.T) {
+	mr := testRedis(t)
+	server := testServer("sync", "BOT1", "TEAM1")
+	d := server.directory()
+	d.putUser(slack.User{ID: "UGONE", Name: "deleted"})
+	d.updateChannel("CGONE", func(c *slack.Channel) { c.Name = "deleted" })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users.list", func(w http.ResponseWriter, r *http.Request) {
+		d.applyEvent(&slack.TeamJoinEvent{User: slack.User{ID: "UNEW", Name: "newbie"}})
+		d.applyEvent(&slack.UserChangeEvent{User: slack.User{ID: "U1", Name: "renamed"}})
+		fmt.Fprint(w, `{"ok": true, "members": [{"id": "U1", "name": "original"}, {"id": "U2", "name": "steady"}]}`)
+	})
+	mux.HandleFunc("/conversations.list", func(w http.ResponseWriter, r *http.Request) {
+		var renamed slack.ChannelRenameEvent
+		renamed.Channel.ID = "C1"
+		renamed.Channel.Name = "new-name"
+		d.applyEvent(&renamed)
+		var created slack.ChannelCreatedEvent
+		created.Channel.ID = "C9"
+		created.Channel.Name = "brand-new"
+		d.applyEvent(&created)
+		fmt.Fprint(w, `{"ok": true, "channels": [{"id": "C1", "name": "old-name"}, {"id": "C2", "name": "steady"}]}`)
+	})
+	fake := httptest.NewServer(mux)
+	defer fake.Close()
+
+	d.sync(slack.New("xoxb-test", slack.OptionAPIURL(fake.URL+"/")))
+
+	users := map[string]string{"U1": "renamed", "U2": "steady", "UNEW": "newbie"}
+	for id, name := range users {
+		if user, ok := d.User(id); !ok || user.Name != name {
+			t.Errorf("user %s is %q (found %v), want %q", id, user.Name, ok, name)
+		}
+		if mr.HGet(directoryUsersKey(server), id) == "" {
+			t.Errorf("user %s isn't cached in redis", id)
+		}
+	}
+	channels := map[string]string{"C1": "new-name", "C2": "steady", "C9": "brand-new"}
+	for id, name := range channels {
+		if channel, ok := d.Channel(id); !ok || channel.Name != name {
+			t.Errorf("channel %s is %q (found %v), want %q", id, channel.Name, ok, name)
+		}
+		if mr.HGet(directoryChannelsKey(server), id) == "" {
+			t.Errorf("channel %s isn't cached in redis", id)
+		}
+	}
+
+	// what slack doesn't know about any more is gone from both
+	if _, ok := d.User("UGONE"); ok || mr.HGet(directoryUsersKey(server), "UGONE") != "" {
+		t.Error("UGONE survived the sync")
+	}
+	if _, ok := d.Channel("CGONE"); ok || mr.HGet(directoryChannelsKey(server), "CGONE") != "" {
+		t.Error("CGONE survived the sync")
+	}
+
+	// once the sync is over, the next one applies its snapshot as usual
+	mux2 := http.NewServeMux()
+	mux2.HandleFunc("/users.list", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok": true, "members": [{"id": "U1", "name": "settled"}]}`)
+	})
+	mux2.HandleFunc("/conversations.list", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok": true, "channels": [{"id": "C1", "name": "settled"}]}`)
+	})
+	fake2 := httptest.NewServer(mux2)
+	defer fake2.Close()
+	d.sync(slack.New("xoxb-test", slack.OptionAPIURL(fake2.URL+"/")))
+	if user, _ := d.User("U1"); user.Name != "settled" {
+		t.Errorf("second sync left U1 as %q", user.Name)
+	}
+	if _, ok := d.User("UNEW"); ok {
+		t.Error("second sync kept UNEW, which slack no longer lists")
+	}
+}
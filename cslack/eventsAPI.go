@@ -0,0 +1,223 @@
+package cslack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+const (
+	maxEventBodySize = 1 << 20
+	eventQueueSize   = 100
+	// authCheckInterval is how often the http transport re-runs auth.test. Nothing else
+	// tells it the token stopped working
+	authCheckInterval = time.Minute
+)
+
+// authErrors are the auth.test errors that mean the token itself is no good
+var authErrors = map[string]bool{
+	"invalid_auth":     true,
+	"not_authed":       true,
+	"account_inactive": true,
+	"token_revoked":    true,
+}
+
+// httpMux serves every HTTP endpoint cslack has. main serves it on the port flag
+var httpMux = http.NewServeMux()
+
+// HTTPHandler is the handler for all of cslack's HTTP endpoints
+func HTTPHandler() http.Handler {
+	return httpMux
+}
+
+// EventsPath is where a server's Events API request URL should point
+func EventsPath(server *SlackServer) string {
+	return "/slack/events/" + url.PathEscape(server.Name)
+}
+
+// eventsAPIEnvelope is the outer wrapper of everything the Events API sends
+type eventsAPIEnvelope struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	TeamID    string          `json:"team_id"`
+	EventID   string          `json:"event_id"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// httpTransport receives the Events API over HTTP
+type httpTransport struct {
+	slackAPI *slack.Client
+	server   *SlackServer
+	events   chan slack.RTMEvent
+	// state is the last connection event sent, so only changes are reported. Only
+	// checkAuth touches it
+	state string
+}
+
+func newHTTPTransport(slackAPI *slack.Client, server *SlackServer) (*httpTransport, error) {
+	if server.SigningSecret == "" {
+		return nil, fmt.Errorf("%s uses the http transport but has no SigningSecret", server.Name)
+	}
+	return &httpTransport{slackAPI: slackAPI, server: server, events: make(chan slack.RTMEvent, eventQueueSize)}, nil
+}
+
+// Start registers the events handler. There's no connection over HTTP to say whether we're
+// up, so the transport reports connected once the handler is in place and auth.test
+// passes, and keeps checking auth.test after that
+func (t *httpTransport) Start() error {
+	httpMux.Handle(EventsPath(t.server), t)
+	glog.Infof("%s listening for the Events API on %s", t.server.Name, EventsPath(t.server))
+	t.checkAuth()
+	go func() {
+		ticker := time.NewTicker(authCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			t.checkAuth()
+		}
+	}()
+	return nil
+}
+
+// checkAuth runs auth.test and sends the connection event for the result if it changed
+func (t *httpTransport) checkAuth() {
+	var ev slack.RTMEvent
+	auth, err := t.slackAPI.AuthTest()
+	switch {
+	case err == nil:
+		ev = slack.RTMEvent{Type: connConnected, Data: &slack.ConnectedEvent{
+			Info: &slack.Info{User: &slack.UserDetails{ID: auth.UserID}, Team: &slack.Team{ID: auth.TeamID}},
+		}}
+	case authErrors[err.Error()]:
+		glog.Errorf("%s auth.test says the token is bad: %s", t.server.Name, err)
+		ev = slack.RTMEvent{Type: connInvalidAuth, Data: &slack.InvalidAuthEvent{}}
+	default:
+		glog.Errorf("%s auth.test failed: %s", t.server.Name, err)
+		countSlackError(t.server, "auth.test")
+		ev = slack.RTMEvent{Type: connDown, Data: &slack.DisconnectedEvent{Cause: err}}
+	}
+	if ev.Type == t.state {
+		return
+	}
+	t.state = ev.Type
+	t.events <- ev
+}
+
+func (t *httpTransport) Events() <-chan slack.RTMEvent {
+	return t.events
+}
+
+func (t *httpTransport) Shared() bool {
+	return false
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := readVerifiedBody(r, t.server.SigningSecret)
+	if err != nil {
+		glog.Errorf("%s rejected an events request: %s", t.server.Name, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var envelope eventsAPIEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	switch envelope.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(envelope.Challenge))
+	case "event_callback":
+		w.WriteHeader(http.StatusOK)
+		t.queue(envelope)
+	case "app_rate_limited":
+		glog.Errorf("%s slack is rate limiting our event subscriptions", t.server.Name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		if *debugCSlack {
+			glog.Infof("%s ignoring events API %s", t.server.Name, envelope.Type)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// queue hands an event to the server manager. Slack wants an answer within 3 seconds so
+// if the manager is that far behind the event is dropped rather than held
+func (t *httpTransport) queue(envelope eventsAPIEnvelope) {
+	ev, err := decodeEventsAPIEvent(envelope)
+	if err != nil {
+		if *debugCSlack {
+			glog.Infof("%s skipping event %s: %s", t.server.Name, envelope.EventID, err)
+		}
+		return
+	}
+	select {
+	case t.events <- ev:
+	default:
+		glog.Errorf("%s event queue full, dropping %s event %s", t.server.Name, ev.Type, envelope.EventID)
+	}
+}
+
+// readVerifiedBody reads a request from slack and checks its X-Slack-Signature against
+// the signing secret
+func readVerifiedBody(r *http.Request, signingSecret string) ([]byte, error) {
+	verifier, err := slack.NewSecretsVerifier(r.Header, signingSecret)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxEventBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return nil, err
+	}
+	if err := verifier.Ensure(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// eventsAPIOnlyTypes are Events API events the RTM doesn't have, mapped to the RTM event
+// with the same shape
+var eventsAPIOnlyTypes = map[string]string{
+	"app_mention": "message",
+}
+
+// decodeEventsAPIEvent turns the inner event of an event_callback into the RTMEvent the
+// RTM would have sent for it. The payloads are the same, so the RTM's own type map works
+func decodeEventsAPIEvent(envelope eventsAPIEnvelope) (slack.RTMEvent, error) {
+	var inner struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(envelope.Event, &inner); err != nil {
+		return slack.RTMEvent{}, err
+	}
+	eventType := inner.Type
+	if mapped, ok := eventsAPIOnlyTypes[eventType]; ok {
+		eventType = mapped
+	}
+	zero, ok := slack.EventMapping[eventType]
+	if !ok {
+		return slack.RTMEvent{}, errors.New("unknown event type " + inner.Type)
+	}
+	data := reflect.New(reflect.TypeOf(zero)).Interface()
+	if err := json.Unmarshal(envelope.Event, data); err != nil {
+		return slack.RTMEvent{}, err
+	}
+	if msg, ok := data.(*slack.MessageEvent); ok && msg.Team == "" {
+		msg.Team = envelope.TeamID
+	}
+	return slack.RTMEvent{Type: eventType, Data: data}, nil
+}
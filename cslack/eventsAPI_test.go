@@ -0,0 +1,106 @@
+package cslack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+func TestHTTPTransportReadiness(t *testing.T) {
+	testRedis(t)
+	var mu sync.Mutex
+	authReply := `{"ok": true, "user_id": "BOT9", "team_id": "TEAM9"}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth.test", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, authReply)
+	})
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok": true, "channel": "C1", "ts": "1.000001"}`)
+	})
+	fake := httptest.NewServer(mux)
+	defer fake.Close()
+	slackAPI := slack.New("xoxb-test", slack.OptionAPIURL(fake.URL+"/"))
+	setAuthReply := func(reply string) {
+		mu.Lock()
+		authReply = reply
+		mu.Unlock()
+	}
+
+	// the events handler can only be registered once per name, so -count runs need their own
+	server := testServer(fmt.Sprintf("http-ready-%d", time.Now().UnixNano()), "", "")
+	server.Transport = TransportHTTP
+	server.SigningSecret = "secret"
+	server.state.conn.set(connStarting)
+	trackServer(server)
+	defer func() {
+		runningMu.Lock()
+		delete(running, server.Name)
+		runningMu.Unlock()
+	}()
+	tr, err := newTransport(slackAPI, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		serveReady(rec, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+		return rec.Code
+	}
+	// step checks auth and feeds whatever it reports through the event loop
+	step := func(check func()) slack.RTMEvent {
+		t.Helper()
+		check()
+		select {
+		case ev := <-tr.Events():
+			handleSlackEvents(ev, slackAPI, server, tr.Shared())
+			return ev
+		default:
+			return slack.RTMEvent{}
+		}
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("before starting /readyz = %d, want 503", code)
+	}
+
+	setAuthReply(`{"ok": false, "error": "invalid_auth"}`)
+	if ev := step(func() { tr.Start() }); ev.Type != connInvalidAuth {
+		t.Fatalf("starting with a bad token sent %q, want %q", ev.Type, connInvalidAuth)
+	}
+	if _, pattern := httpMux.Handler(httptest.NewRequest(http.MethodPost, EventsPath(server), nil)); pattern != EventsPath(server) {
+		t.Errorf("events handler isn't registered, %s routes to %q", EventsPath(server), pattern)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("with a bad token /readyz = %d, want 503", code)
+	}
+
+	check := tr.(*httpTransport).checkAuth
+	setAuthReply(`{"ok": true, "user_id": "BOT9", "team_id": "TEAM9"}`)
+	if ev := step(check); ev.Type != connConnected {
+		t.Fatalf("with a good token sent %q, want %q", ev.Type, connConnected)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("once auth.test passes /readyz = %d, want 200", code)
+	}
+	if server.botID() != "BOT9" || server.teamID() != "TEAM9" {
+		t.Errorf("identity is %s/%s, want auth.test's BOT9/TEAM9", server.botID(), server.teamID())
+	}
+	if ev := step(check); ev.Type != "" {
+		t.Errorf("passing again sent %q, want nothing new", ev.Type)
+	}
+
+	setAuthReply(`{"ok": false, "error": "fatal_error"}`)
+	if ev := step(check); ev.Type != connDown {
+		t.Fatalf("with slack failing sent %q, want %q", ev.Type, connDown)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("with auth.test failing /readyz = %d, want 503", code)
+	}
+}
@@ -0,0 +1,133 @@
+package cslack
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+)
+
+const (
+	// HealthPath is the liveness probe. It fails when a pod needs restarting
+	HealthPath = "/healthz"
+	// ReadyPath is the readiness probe. It fails while a pod can't do its job
+	ReadyPath = "/readyz"
+	// disconnectedTooLong is how long a server can be down before the pod counts as wedged
+	disconnectedTooLong = 5 * time.Minute
+)
+
+// connection states a server can be in
+const (
+	connStarting    = "starting"
+	connConnected   = "connected"
+	connDown        = "disconnected"
+	connInvalidAuth = "invalid_auth"
+)
+
+// connState is how a server's connection to slack is doing
+type connState struct {
+	mu    sync.Mutex
+	state string
+	since time.Time
+}
+
+func (c *connState) set(state string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != state {
+		c.state = state
+		c.since = time.Now()
+	}
+}
+
+func (c *connState) get() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state, c.since
+}
+
+// serverHealth is one server's part of a health report
+type serverHealth struct {
+	Connection string    `json:"connection"`
+	Since      time.Time `json:"since"`
+}
+
+// healthReport is the json body of both probes
+type healthReport struct {
+	OK      bool                    `json:"ok"`
+	Redis   string                  `json:"redis"`
+	Leader  bool                    `json:"leader"`
+	Servers map[string]serverHealth `json:"servers"`
+}
+
+var (
+	runningMu sync.Mutex
+	// running is every server whose manager has started, by name
+	running = make(map[string]*SlackServer)
+)
+
+func init() {
+	httpMux.HandleFunc(HealthPath, serveHealth)
+	httpMux.HandleFunc(ReadyPath, serveReady)
+}
+
+func trackServer(server *SlackServer) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	running[server.Name] = server
+}
+
+func healthSnapshot() healthReport {
+	report := healthReport{OK: true, Redis: "ok", Leader: isLeader(), Servers: make(map[string]serverHealth)}
+	if err := redis_wrapper.Ping(); err != nil {
+		report.Redis = err.Error()
+	}
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	for name, server := range running {
+		state, since := server.state.conn.get()
+		report.Servers[name] = serverHealth{Connection: state, Since: since}
+	}
+	return report
+}
+
+// serveHealth fails if a server's credentials are bad or it has been disconnected for
+// too long. A redis outage doesn't count, restarting won't fix that
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	report := healthSnapshot()
+	for _, server := range report.Servers {
+		switch server.Connection {
+		case connInvalidAuth:
+			report.OK = false
+		case connDown:
+			if time.Since(server.Since) > disconnectedTooLong {
+				report.OK = false
+			}
+		}
+	}
+	writeHealth(w, report)
+}
+
+// serveReady fails until redis answers and every server is connected
+func serveReady(w http.ResponseWriter, r *http.Request) {
+	report := healthSnapshot()
+	if report.Redis != "ok" {
+		report.OK = false
+	}
+	for _, server := range report.Servers {
+		if server.Connection != connConnected {
+			report.OK = false
+		}
+	}
+	writeHealth(w, report)
+}
+
+func writeHealth(w http.ResponseWriter, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
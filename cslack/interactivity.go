@@ -0,0 +1,116 @@
+package cslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// ActionHandler runs when someone clicks a button the bot posted. Errors returned are logged
+type ActionHandler func(a *ActionContext) error
+
+// ActionContext is everything an ActionHandler gets to work with
+type ActionContext struct {
+	Callback slack.InteractionCallback
+	// Action is the button that was clicked
+	Action   *slack.BlockAction
+	SlackAPI *slack.Client
+	Server   *SlackServer
+}
+
+// interactionEvent is an interaction that came in over socket mode
+type interactionEvent struct {
+	Callback slack.InteractionCallback
+}
+
+var actions = make(map[string]ActionHandler)
+
+// RegisterAction routes block_actions with actionID to handler. Like commands, actions
+// register themselves from init(). Registering an id twice panics
+func RegisterAction(actionID string, handler ActionHandler) {
+	if actionID == "" || handler == nil {
+		panic("cslack: actions need an id and a handler")
+	}
+	if _, exists := actions[actionID]; exists {
+		panic(fmt.Sprintf("cslack: action %q registered twice", actionID))
+	}
+	actions[actionID] = handler
+}
+
+// Reply answers the person who clicked, privately
+func (a *ActionContext) Reply(msg string) error {
+	return postToResponseURL(a.Callback.ResponseURL, msg, nil)
+}
+
+// ReplyBlocks is Reply with Block Kit blocks. msg is still needed as the fallback text
+func (a *ActionContext) ReplyBlocks(msg string, blocks ...slack.Block) error {
+	return postToResponseURL(a.Callback.ResponseURL, msg, blocks)
+}
+
+// InteractionsPath is where a server's interactivity request URL should point
+func InteractionsPath(server *SlackServer) string {
+	return "/slack/interactions/" + url.PathEscape(server.Name)
+}
+
+// registerInteractivity serves the server's interactivity endpoint. It needs a SigningSecret
+func registerInteractivity(slackAPI *slack.Client, server *SlackServer) {
+	httpMux.HandleFunc(InteractionsPath(server), func(w http.ResponseWriter, r *http.Request) {
+		serveInteraction(w, r, slackAPI, server)
+	})
+	glog.Infof("%s listening for interactions on %s", server.Name, InteractionsPath(server))
+}
+
+func serveInteraction(w http.ResponseWriter, r *http.Request, slackAPI *slack.Client, server *SlackServer) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := readVerifiedBody(r, server.SigningSecret)
+	if err != nil {
+		glog.Errorf("%s rejected an interaction: %s", server.Name, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		glog.Errorf("%s bad interaction payload: %s", server.Name, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// handlers answer through the response_url, so slack can have its 200 right away
+	w.WriteHeader(http.StatusOK)
+	go handleInteraction(callback, slackAPI, server)
+}
+
+// handleInteraction runs the handler for each button in a block_actions payload
+func handleInteraction(callback slack.InteractionCallback, slackAPI *slack.Client, server *SlackServer) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		if *debugCSlack {
+			glog.Infof("%s ignoring %s interaction", server.Name, callback.Type)
+		}
+		return
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		handler, ok := actions[action.ActionID]
+		if !ok {
+			glog.Errorf("%s no handler for action %s from %s", server.Name, action.ActionID, callback.User.ID)
+			continue
+		}
+		if *debugCSlack {
+			glog.Infof("%s %s clicked %s (%s)", server.Name, callback.User.ID, action.ActionID, action.Value)
+		}
+		a := &ActionContext{Callback: callback, Action: action, SlackAPI: slackAPI, Server: server}
+		if err := handler(a); err != nil {
+			glog.Errorf("%s error handling %s from %s: %s", server.Name, action.ActionID, callback.User.ID, err)
+		}
+	}
+}
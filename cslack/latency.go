@@ -1,51 +1,184 @@
 package cslack
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/craigske/cluebatbot/redis_wrapper"
 	"github.com/golang/glog"
+	"github.com/nlopes/slack"
 )
 
-// TODO: refactor out to file. All events should be separate files
-func handleLatency(latency time.Duration, server *SlackServer) {
-	// report only high latency
-	var latencyThreshold = time.Duration(2 * time.Second)
-	if int64(latency) > int64(latencyThreshold) {
-		glog.Errorf("%s latency over threshold(%s): %s", server.Name, latencyThreshold, latency)
-	}
-	server.LatencySlice = append(server.LatencySlice, latency.Nanoseconds())
-	// if *debugCSlack {
-	// 	for i, l := range server.LatencySlice {
-	// 		glog.Infof("%s latencySlice %d = %d", server.Name, i, l)
-	// 	}
-	// }
-	if server.LatencyCounter == 10 {
-		var total int64
-		for _, l := range server.LatencySlice {
-			total += l
+const (
+	defaultLatencyWindow    = 60
+	defaultLatencyRetention = 7 * 24 * time.Hour
+	// latencyTrimEvery is how many samples go by between trims of the history
+	latencyTrimEvery = 20
+)
+
+// LatencyStats summarizes a set of latency samples
+type LatencyStats struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// latencyTracker keeps the last size samples in a ring, so memory stays put however long
+// the bot runs
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+	// added counts every sample ever, for deciding when to trim redis
+	added int
+}
+
+func newLatencyTracker(size int) *latencyTracker {
+	if size <= 0 {
+		size = defaultLatencyWindow
+	}
+	return &latencyTracker{samples: make([]time.Duration, size)}
+}
+
+// add records a sample and returns how many samples have been added in total
+func (t *latencyTracker) add(d time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = d
+	t.next++
+	if t.next == len(t.samples) {
+		t.next = 0
+		t.full = true
+	}
+	t.added++
+	return t.added
+}
+
+// stats summarizes the samples in the window
+func (t *latencyTracker) stats() LatencyStats {
+	t.mu.Lock()
+	n := t.next
+	if t.full {
+		n = len(t.samples)
+	}
+	window := make([]time.Duration, n)
+	copy(window, t.samples[:n])
+	t.mu.Unlock()
+	return latencyStats(window)
+}
+
+// latencyStats works out nearest rank percentiles. samples is sorted in place
+func latencyStats(samples []time.Duration) LatencyStats {
+	stats := LatencyStats{Count: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	percentile := func(p int) time.Duration {
+		rank := (p*len(samples) + 99) / 100
+		if rank < 1 {
+			rank = 1
 		}
-		avg := total / int64(len(server.LatencySlice))
-		// save to redis
-		now := time.Now()
-		jsonNow, err := now.MarshalJSON()
-		if err != nil {
-			glog.Error("time conversion error: " + err.Error())
+		return samples[rank-1]
+	}
+	stats.P50 = percentile(50)
+	stats.P95 = percentile(95)
+	stats.P99 = percentile(99)
+	stats.Max = samples[len(samples)-1]
+	return stats
+}
+
+func (s LatencyStats) String() string {
+	if s.Count == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("p50 %s, p95 %s, p99 %s, max %s over %d samples",
+		s.P50.Round(time.Millisecond), s.P95.Round(time.Millisecond), s.P99.Round(time.Millisecond),
+		s.Max.Round(time.Millisecond), s.Count)
+}
+
+// Latency history is a sorted set per server scored by unix milliseconds. Members are
+// "millis:nanoseconds" so two samples with the same latency stay distinct. Only the leader
+// writes it, so it is the history of the connection handling events and replicas' samples
+// don't get mixed in
+func latencyKey(server *SlackServer) string {
+	return server.Name + ":latency"
+}
+
+func latencyRetention(server *SlackServer) time.Duration {
+	if server.LatencyRetentionHours > 0 {
+		return time.Duration(server.LatencyRetentionHours) * time.Hour
+	}
+	return defaultLatencyRetention
+}
+
+func saveLatency(server *SlackServer, at time.Time, latency time.Duration) error {
+	millis := at.UnixNano() / int64(time.Millisecond)
+	return redis_wrapper.ZAdd(latencyKey(server), millis, fmt.Sprintf("%d:%d", millis, latency.Nanoseconds()))
+}
+
+// dropLegacyLatencyKeys deletes the <server>:latency:"<json time>" averages the bot wrote
+// before it kept a history. Nothing reads them, and the scan is cheap once they're gone
+func dropLegacyLatencyKeys(server *SlackServer) {
+	dropKeysMatching(server, server.Name+`:latency:"*`)
+}
+
+// trimLatency drops history older than the server's retention
+func trimLatency(server *SlackServer, now time.Time) error {
+	cutoff := now.Add(-latencyRetention(server)).UnixNano() / int64(time.Millisecond)
+	_, err := redis_wrapper.ZRemRangeByScore(latencyKey(server), "-inf", "("+strconv.FormatInt(cutoff, 10))
+	return err
+}
+
+// latencySince summarizes the saved samples since a time
+func latencySince(server *SlackServer, since time.Time) (LatencyStats, error) {
+	min := strconv.FormatInt(since.UnixNano()/int64(time.Millisecond), 10)
+	members, err := redis_wrapper.ZRangeByScore(latencyKey(server), min, "+inf")
+	if err != nil {
+		return LatencyStats{}, err
+	}
+	samples := make([]time.Duration, 0, len(members))
+	for _, member := range members {
+		parts := strings.SplitN(member, ":", 2)
+		if len(parts) != 2 {
+			continue
 		}
-		key := server.Name + ":latency:" + string(jsonNow)
-		jsonLatency := string(avg)
-		redis_wrapper.Set(key, []byte(jsonLatency))
-		glog.Infof("%s avg latency now %s", server.Name, time.Duration(avg))
-		server.LatencyCounter = 0
-	} else {
-		if *debugCSlack && *debugLatencyTick {
-			glog.Infof("%s Tick %d", server.Name, server.LatencyCounter)
+		ns, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
 		}
-		server.LatencyCounter++
+		samples = append(samples, time.Duration(ns))
 	}
-	glog.Flush()
+	return latencyStats(samples), nil
 }
 
-// func reportLatency(server SlackServer) {
-
-// }
+// handleLatency records an RTM latency report and checks it against the alert rules
+func handleLatency(latency time.Duration, slackAPI *slack.Client, server *SlackServer) {
+	latencyHistogram.WithLabelValues(server.Name).Observe(latency.Seconds())
+	added := server.state.latency.add(latency)
+	if *debugCSlack && *debugLatencyTick {
+		glog.Infof("%s Tick %d: %s", server.Name, added, latency)
+	}
+	now := time.Now()
+	if isLeader() {
+		if err := saveLatency(server, now, latency); err != nil {
+			glog.Errorf("%s error saving latency: %s", server.Name, err)
+		}
+		if added%latencyTrimEvery == 0 {
+			if err := trimLatency(server, now); err != nil {
+				glog.Errorf("%s error trimming latency history: %s", server.Name, err)
+			}
+		}
+	}
+	if added%latencyTrimEvery == 0 {
+		glog.Infof("%s latency %s", server.Name, server.state.latency.stats())
+	}
+	checkLatencyAlerts(latency, slackAPI, server)
+}
@@ -0,0 +1,199 @@
+package cslack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// LatencyAlert is a rule for telling the owners slack is slow. It fires once Samples
+// latency reports in a row are over ThresholdMillis, and resolves once Samples reports in a
+// row are at or under ResolveMillis. Keeping ResolveMillis below ThresholdMillis stops an
+// alert flapping when latency hovers around the line. Set ThresholdMillis to -1 to turn a
+// rule off
+type LatencyAlert struct {
+	Name            string `json:"Name"`
+	ThresholdMillis int    `json:"ThresholdMillis"`
+	// ResolveMillis defaults to three quarters of ThresholdMillis
+	ResolveMillis int `json:"ResolveMillis"`
+	// Samples defaults to 5
+	Samples int `json:"Samples"`
+	// Notify is "channel" (the default) for the control channel, or "owner" to DM the
+	// owners. Without a control channel it DMs them either way
+	Notify string `json:"Notify"`
+}
+
+const (
+	notifyChannel = "channel"
+	notifyOwner   = "owner"
+
+	defaultAlertSamples = 5
+)
+
+var defaultLatencyAlerts = []LatencyAlert{{Name: "slow", ThresholdMillis: 2000}}
+
+func (rule LatencyAlert) withDefaults() LatencyAlert {
+	if rule.Samples <= 0 {
+		rule.Samples = defaultAlertSamples
+	}
+	if rule.ResolveMillis <= 0 || rule.ResolveMillis > rule.ThresholdMillis {
+		rule.ResolveMillis = rule.ThresholdMillis * 3 / 4
+	}
+	if rule.Notify != notifyOwner {
+		rule.Notify = notifyChannel
+	}
+	return rule
+}
+
+func (rule LatencyAlert) off() bool {
+	return rule.ThresholdMillis < 0
+}
+
+func (rule LatencyAlert) threshold() time.Duration {
+	return time.Duration(rule.ThresholdMillis) * time.Millisecond
+}
+
+func (rule LatencyAlert) resolve() time.Duration {
+	return time.Duration(rule.ResolveMillis) * time.Millisecond
+}
+
+// latencyAlertRules is the server's rules with the defaults filled in. Unset uses
+// defaultLatencyAlerts
+func latencyAlertRules(server *SlackServer) []LatencyAlert {
+	rules := server.LatencyAlerts
+	if rules == nil {
+		rules = defaultLatencyAlerts
+	}
+	filled := make([]LatencyAlert, 0, len(rules))
+	for i, rule := range rules {
+		if rule.off() {
+			continue
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("latency-%d", i+1)
+		}
+		filled = append(filled, rule.withDefaults())
+	}
+	return filled
+}
+
+// alertState is where one rule is up to. run counts reports in a row on the far side of
+// whichever line matters right now, over the threshold while quiet or under the resolve
+// line while firing
+type alertState struct {
+	firing  bool
+	run     int
+	firedAt time.Time
+	worst   time.Duration
+}
+
+// alertChange is a rule firing or resolving
+type alertChange struct {
+	rule     LatencyAlert
+	resolved bool
+	latency  time.Duration
+	// worst and firedAt are only set when resolved
+	worst   time.Duration
+	firedAt time.Time
+}
+
+// latencyAlerter runs a server's rules over its latency reports
+type latencyAlerter struct {
+	mu     sync.Mutex
+	rules  []LatencyAlert
+	states []alertState
+}
+
+func newLatencyAlerter(server *SlackServer) *latencyAlerter {
+	rules := latencyAlertRules(server)
+	return &latencyAlerter{rules: rules, states: make([]alertState, len(rules))}
+}
+
+// observe feeds a report through every rule and returns the ones that changed
+func (a *latencyAlerter) observe(latency time.Duration, now time.Time) []alertChange {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var changes []alertChange
+	for i, rule := range a.rules {
+		state := &a.states[i]
+		if !state.firing {
+			if latency > rule.threshold() {
+				state.run++
+			} else {
+				state.run = 0
+			}
+			if state.run >= rule.Samples {
+				*state = alertState{firing: true, firedAt: now, worst: latency}
+				changes = append(changes, alertChange{rule: rule, latency: latency})
+			}
+			continue
+		}
+		if latency > state.worst {
+			state.worst = latency
+		}
+		if latency <= rule.resolve() {
+			state.run++
+		} else {
+			state.run = 0
+		}
+		if state.run >= rule.Samples {
+			changes = append(changes, alertChange{rule: rule, resolved: true, latency: latency, worst: state.worst, firedAt: state.firedAt})
+			*state = alertState{}
+		}
+	}
+	return changes
+}
+
+// firing lists the rules that are firing now
+func (a *latencyAlerter) firing() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var names []string
+	for i, rule := range a.rules {
+		if a.states[i].firing {
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
+
+func (c alertChange) message(server *SlackServer, now time.Time) string {
+	if c.resolved {
+		return fmt.Sprintf(":white_check_mark: latency alert `%s` resolved on %s after %s: the last %d reports were at or under %s. Worst was %s",
+			c.rule.Name, server.Name, now.Sub(c.firedAt).Round(time.Second), c.rule.Samples, c.rule.resolve(), c.worst.Round(time.Millisecond))
+	}
+	return fmt.Sprintf(":warning: latency alert `%s` on %s: the last %d reports were over %s, latest %s. Now %s",
+		c.rule.Name, server.Name, c.rule.Samples, c.rule.threshold(), c.latency.Round(time.Millisecond), server.state.latency.stats())
+}
+
+// checkLatencyAlerts runs a report through the server's rules and tells the owners about
+// anything that fired or resolved. Every replica keeps its rules current, but only the
+// leader posts
+func checkLatencyAlerts(latency time.Duration, slackAPI *slack.Client, server *SlackServer) {
+	now := time.Now()
+	for _, change := range server.state.alerts.observe(latency, now) {
+		if change.resolved {
+			latencyAlertGauge.WithLabelValues(server.Name, change.rule.Name).Set(0)
+			glog.Infof("%s latency alert %s resolved", server.Name, change.rule.Name)
+		} else {
+			latencyAlertGauge.WithLabelValues(server.Name, change.rule.Name).Set(1)
+			glog.Errorf("%s latency alert %s: %d reports over %s", server.Name, change.rule.Name, change.rule.Samples, change.rule.threshold())
+		}
+		if !isLeader() {
+			continue
+		}
+		msg := change.message(server, now)
+		var err error
+		if change.rule.Notify == notifyOwner {
+			err = dmOwners(slackAPI, server, msg)
+		} else {
+			err = tellOwners(slackAPI, server, msg)
+		}
+		if err != nil {
+			glog.Errorf("%s error posting latency alert %s: %s", server.Name, change.rule.Name, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package cslack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDropLegacyLatencyKeys(t *testing.T) {
+	mr := testRedis(t)
+	server := testServer("lat", "BOT1", "TEAM1")
+	other := testServer("other", "BOT2", "TEAM2")
+
+	mr.Set(`lat:latency:"2019-03-01T10:00:00Z"`, "1500000")
+	mr.Set(`lat:latency:"2019-03-01T10:01:00Z"`, "1600000")
+	mr.Set(`other:latency:"2019-03-01T10:00:00Z"`, "1500000")
+	now := time.Now()
+	if err := saveLatency(server, now, 250*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	dropLegacyLatencyKeys(server)
+
+	for _, key := range mr.Keys() {
+		if key != latencyKey(server) && key != `other:latency:"2019-03-01T10:00:00Z"` {
+			t.Errorf("%s is still in redis", key)
+		}
+	}
+	if !mr.Exists(`other:latency:"2019-03-01T10:00:00Z"`) {
+		t.Errorf("dropped %s's keys too", other.Name)
+	}
+	stats, err := latencySince(server, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 1 || stats.Max != 250*time.Millisecond {
+		t.Errorf("history after the cleanup is %s, want the one sample", stats)
+	}
+}
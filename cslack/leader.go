@@ -0,0 +1,92 @@
+package cslack
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+)
+
+const (
+	leaderKey   = "cluebatbot:leader"
+	leaderTTL   = 6 * time.Second
+	leaderRenew = 2 * time.Second
+)
+
+// LeaderElector keeps a redis lock so only one replica answers commands and delivers
+// scheduled bats. Every replica keeps its RTM connections open, so a standby can take
+// over as soon as the leader's lock expires
+type LeaderElector struct {
+	id string
+	// leaderOnError makes this replica act as leader when redis can't be reached
+	leaderOnError bool
+	leader        int32
+	stop          chan struct{}
+}
+
+// elector is nil until StartLeaderElection is called, and a nil elector is always leader
+var elector *LeaderElector
+
+// StartLeaderElection starts campaigning for leadership as id, which must be unique to
+// this replica (the pod name works)
+func StartLeaderElection(id string, leaderOnError bool) *LeaderElector {
+	elector = &LeaderElector{id: id, leaderOnError: leaderOnError, stop: make(chan struct{})}
+	elector.campaign()
+	go elector.run()
+	return elector
+}
+
+// IsLeader reports whether this replica should be handling events
+func (l *LeaderElector) IsLeader() bool {
+	if l == nil {
+		return true
+	}
+	return atomic.LoadInt32(&l.leader) == 1
+}
+
+// Stop gives up leadership so a standby can take over without waiting for the lock to expire
+func (l *LeaderElector) Stop() {
+	close(l.stop)
+	if err := redis_wrapper.ReleaseLock(leaderKey, l.id); err != nil {
+		glog.Errorf("%s error releasing leadership: %s", l.id, err)
+	}
+	atomic.StoreInt32(&l.leader, 0)
+}
+
+func (l *LeaderElector) run() {
+	ticker := time.NewTicker(leaderRenew)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.campaign()
+		}
+	}
+}
+
+func (l *LeaderElector) campaign() {
+	won, err := redis_wrapper.AcquireLock(leaderKey, l.id, leaderTTL)
+	if err != nil {
+		glog.Errorf("%s leader election error: %s", l.id, err)
+		won = l.leaderOnError
+	}
+	var now int32
+	if won {
+		now = 1
+	}
+	if was := atomic.SwapInt32(&l.leader, now); was != now {
+		if won {
+			glog.Infof("%s is now the leader", l.id)
+		} else {
+			glog.Infof("%s is now a standby", l.id)
+		}
+	}
+}
+
+// isLeader is the package's view of leadership, true when there's no election running
+func isLeader() bool {
+	return elector.IsLeader()
+}
@@ -0,0 +1,163 @@
+package cslack
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+)
+
+// BatEvent is one delivered cluebat, as kept in the ledger
+type BatEvent struct {
+	ID        string    `json:"ID"`
+	Sender    string    `json:"Sender"`
+	Target    string    `json:"Target"`
+	Channel   string    `json:"Channel"`
+	Template  string    `json:"Template"`
+	Timestamp time.Time `json:"Timestamp"`
+	// MessageTS is slack's ts for the bat message, which is what chat.delete wants
+	MessageTS string `json:"MessageTS"`
+	// QuotaID is what the bat's rate limit hits are filed under, for refunding them
+	QuotaID string `json:"QuotaID,omitempty"`
+}
+
+// The ledger is three sorted sets of BatEvent json scored by unix time: every bat on
+// the server, and every bat per target and per sender
+func ledgerKey(server *SlackServer) string {
+	return server.Name + ":bats"
+}
+
+func ledgerTargetKey(server *SlackServer, userID string) string {
+	return server.Name + ":bats:target:" + userID
+}
+
+func ledgerSenderKey(server *SlackServer, userID string) string {
+	return server.Name + ":bats:sender:" + userID
+}
+
+// recordBat writes a bat to the ledger, filling in its id
+func recordBat(server *SlackServer, event BatEvent) (BatEvent, error) {
+	next, err := redis_wrapper.Incr(ledgerKey(server) + ":nextid")
+	if err != nil {
+		return event, err
+	}
+	event.ID = strconv.Itoa(next)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return event, err
+	}
+	score := event.Timestamp.Unix()
+	for _, key := range []string{ledgerKey(server), ledgerTargetKey(server, event.Target), ledgerSenderKey(server, event.Sender)} {
+		if err := redis_wrapper.ZAdd(key, score, string(data)); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+// batCount is how many bats target has taken on the server
+func batCount(server *SlackServer, target string) (int, error) {
+	return redis_wrapper.ZCard(ledgerTargetKey(server, target))
+}
+
+func decodeBatEvents(server *SlackServer, members []string) []BatEvent {
+	events := make([]BatEvent, 0, len(members))
+	for _, member := range members {
+		var event BatEvent
+		if err := json.Unmarshal([]byte(member), &event); err != nil {
+			glog.Errorf("%s skipping unreadable ledger entry: %s", server.Name, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// batsSince gets every bat on the server since a time, oldest first. A zero time means all
+func batsSince(server *SlackServer, since time.Time) ([]BatEvent, error) {
+	min := "-inf"
+	if !since.IsZero() {
+		min = strconv.FormatInt(since.Unix(), 10)
+	}
+	members, err := redis_wrapper.ZRangeByScore(ledgerKey(server), min, "+inf")
+	if err != nil {
+		return nil, err
+	}
+	return decodeBatEvents(server, members), nil
+}
+
+// batsAgainst gets the latest count bats that hit target, newest first
+func batsAgainst(server *SlackServer, target string, count int) ([]BatEvent, error) {
+	members, err := redis_wrapper.ZRevRangeByScore(ledgerTargetKey(server, target), "+inf", "-inf", count)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBatEvents(server, members), nil
+}
+
+// LeaderboardEntry is a user and how many bats they took or threw
+type LeaderboardEntry struct {
+	User  string
+	Count int
+}
+
+// leaderboard tallies the most batted and the most active batters, top n of each
+func leaderboard(events []BatEvent, n int) ([]LeaderboardEntry, []LeaderboardEntry) {
+	targets := make(map[string]int)
+	senders := make(map[string]int)
+	for _, event := range events {
+		targets[event.Target]++
+		senders[event.Sender]++
+	}
+	return topN(targets, n), topN(senders, n)
+}
+
+func topN(counts map[string]int, n int) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(counts))
+	for user, count := range counts {
+		entries = append(entries, LeaderboardEntry{User: user, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].User < entries[j].User
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// batByMessage finds the bat whose message is ts in channel. The raw ledger member comes
+// back too, for forgetBat. False means the ledger has no such bat
+func batByMessage(server *SlackServer, channel string, ts string) (BatEvent, string, bool, error) {
+	score := strconv.FormatInt(slackTimestampToTime(ts).Unix(), 10)
+	members, err := redis_wrapper.ZRangeByScore(ledgerKey(server), score, score)
+	if err != nil {
+		return BatEvent{}, "", false, err
+	}
+	for _, member := range members {
+		var event BatEvent
+		if err := json.Unmarshal([]byte(member), &event); err != nil {
+			continue
+		}
+		if event.Channel == channel && event.MessageTS == ts {
+			return event, member, true, nil
+		}
+	}
+	return BatEvent{}, "", false, nil
+}
+
+// forgetBat takes a bat out of the ledger, like it never happened
+func forgetBat(server *SlackServer, event BatEvent, raw string) error {
+	for _, key := range []string{ledgerKey(server), ledgerTargetKey(server, event.Target), ledgerSenderKey(server, event.Sender)} {
+		if _, err := redis_wrapper.ZRem(key, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cslack
+
+import (
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is where prometheus scrapes
+const MetricsPath = "/metrics"
+
+// Command outcomes, for the commands metric
+const (
+	outcomeOK       = "ok"
+	outcomeError    = "error"
+	outcomeDenied   = "denied"
+	outcomeDisabled = "disabled"
+	outcomeBadArgs  = "bad_args"
+)
+
+var (
+	latencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cluebatbot_rtm_latency_seconds",
+		Help:    "RTM ping latency reported by slack.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 5, 10},
+	}, []string{"server"})
+	eventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluebatbot_events_total",
+		Help: "Events received from slack, by type.",
+	}, []string{"server", "type"})
+	commandsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluebatbot_commands_total",
+		Help: "Commands run, by name and outcome.",
+	}, []string{"server", "command", "outcome"})
+	slackErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluebatbot_slack_api_errors_total",
+		Help: "Failed slack API calls, by method.",
+	}, []string{"server", "method"})
+	batsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluebatbot_bats_sent_total",
+		Help: "Cluebats delivered.",
+	}, []string{"server"})
+	latencyAlertGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cluebatbot_latency_alert_firing",
+		Help: "1 while a latency alert rule is firing.",
+	}, []string{"server", "rule"})
+	redisActive = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cluebatbot_redis_pool_active_connections",
+		Help: "Redis connections in the pool, idle ones included.",
+	}, func() float64 { return redisPoolStat(false) })
+	redisIdle = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cluebatbot_redis_pool_idle_connections",
+		Help: "Idle redis connections in the pool.",
+	}, func() float64 { return redisPoolStat(true) })
+)
+
+func init() {
+	prometheus.MustRegister(latencyHistogram, eventsCounter, commandsCounter, slackErrorsCounter, batsCounter, latencyAlertGauge, redisActive, redisIdle)
+	httpMux.Handle(MetricsPath, promhttp.Handler())
+}
+
+func redisPoolStat(idle bool) float64 {
+	if redis_wrapper.Pool == nil {
+		return 0
+	}
+	stats := redis_wrapper.Pool.Stats()
+	if idle {
+		return float64(stats.IdleCount)
+	}
+	return float64(stats.ActiveCount)
+}
+
+func countCommand(server *SlackServer, cmd *Command, outcome string) {
+	commandsCounter.WithLabelValues(server.Name, cmd.Name, outcome).Inc()
+}
+
+// countSlackError records a failed slack call. method is the API method, like chat.postMessage
+func countSlackError(server *SlackServer, method string) {
+	slackErrorsCounter.WithLabelValues(server.Name, method).Inc()
+}
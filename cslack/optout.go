@@ -0,0 +1,36 @@
+package cslack
+
+import (
+	"fmt"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+)
+
+// optedOutError is what deliverClueBat returns when the target doesn't want cluebats
+type optedOutError struct {
+	Target string
+}
+
+func (e optedOutError) Error() string {
+	return fmt.Sprintf("<@%s> has opted out of cluebats, so I didn't send one. Maybe just talk to them?", e.Target)
+}
+
+func optOutKey(server *SlackServer) string {
+	return server.Name + ":optout"
+}
+
+func optOut(server *SlackServer, userID string) error {
+	return redis_wrapper.SAdd(optOutKey(server), userID)
+}
+
+func optIn(server *SlackServer, userID string) error {
+	return redis_wrapper.SRem(optOutKey(server), userID)
+}
+
+func isOptedOut(server *SlackServer, userID string) (bool, error) {
+	return redis_wrapper.SIsMember(optOutKey(server), userID)
+}
+
+func optedOutUsers(server *SlackServer) ([]string, error) {
+	return redis_wrapper.SMembers(optOutKey(server))
+}
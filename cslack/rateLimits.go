@@ -0,0 +1,135 @@
+package cslack
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+)
+
+// Quota allows Count bats in any WindowSeconds long stretch. Leave it zero for the
+// default, or set Count to -1 for no limit
+type Quota struct {
+	Count         int `json:"Count"`
+	WindowSeconds int `json:"WindowSeconds"`
+}
+
+// RateLimits are a server's bat quotas. PerChannel counts bats landing in a channel
+type RateLimits struct {
+	PerSender  Quota `json:"PerSender"`
+	PerTarget  Quota `json:"PerTarget"`
+	PerChannel Quota `json:"PerChannel"`
+}
+
+var (
+	defaultSenderQuota  = Quota{Count: 10, WindowSeconds: 3600}
+	defaultTargetQuota  = Quota{Count: 3, WindowSeconds: 3600}
+	defaultChannelQuota = Quota{Count: 5, WindowSeconds: 3600}
+)
+
+func (q Quota) orDefault(def Quota) Quota {
+	if q.Count == 0 {
+		return def
+	}
+	if q.WindowSeconds <= 0 {
+		q.WindowSeconds = def.WindowSeconds
+	}
+	return q
+}
+
+func (q Quota) unlimited() bool {
+	return q.Count < 0
+}
+
+func (q Quota) window() time.Duration {
+	return time.Duration(q.WindowSeconds) * time.Second
+}
+
+func senderQuota(server *SlackServer) Quota {
+	return server.RateLimits.PerSender.orDefault(defaultSenderQuota)
+}
+
+func targetQuota(server *SlackServer) Quota {
+	return server.RateLimits.PerTarget.orDefault(defaultTargetQuota)
+}
+
+func channelQuota(server *SlackServer) Quota {
+	return server.RateLimits.PerChannel.orDefault(defaultChannelQuota)
+}
+
+// Each quota is a sliding window, a sorted set of hits per server, kind and id. The key
+// changed from the fixed window counters' ":ratelimit:" so old string keys can't collide
+func rateLimitKey(server *SlackServer, kind string, id string) string {
+	return server.Name + ":ratewindow:" + kind + ":" + id
+}
+
+// newQuotaID names one bat's hits. The same id goes in every window the bat touches, so
+// a failed delivery or an undo can hand them all back
+func newQuotaID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(uint64(rand.Uint32()), 36)
+}
+
+// reserveQuota takes a hit of kind/id for quotaID if there's room, and otherwise says how
+// long until there will be. Redis trouble lets the bat through rather than blocking everyone
+func reserveQuota(server *SlackServer, quota Quota, kind string, id string, quotaID string) (bool, time.Duration) {
+	if quota.unlimited() {
+		return true, 0
+	}
+	ok, retryAfter, err := redis_wrapper.ReserveRateLimit(rateLimitKey(server, kind, id), quotaID, quota.Count, quota.window(), time.Now())
+	if err != nil {
+		glog.Errorf("%s error checking %s rate limit for %s, allowing it: %s", server.Name, kind, id, err)
+		return true, 0
+	}
+	return ok, retryAfter
+}
+
+func refundQuota(server *SlackServer, quota Quota, kind string, id string, quotaID string) {
+	if quota.unlimited() {
+		return
+	}
+	if err := redis_wrapper.RefundRateLimit(rateLimitKey(server, kind, id), quotaID); err != nil {
+		glog.Errorf("%s error refunding %s rate limit for %s: %s", server.Name, kind, id, err)
+	}
+}
+
+// reserveBatLimits takes the sender's and target's quota before a bat goes out, so bats
+// racing each other can't both squeeze into the last slot. The error says when the sender
+// can try again
+func reserveBatLimits(server *SlackServer, req batRequest, quotaID string) error {
+	if ok, retryAfter := reserveQuota(server, senderQuota(server), "sender", req.Sender, quotaID); !ok {
+		return fmt.Errorf("easy there, you've used up your cluebats for now. You can bat again %s", retryWhen(retryAfter))
+	}
+	if ok, retryAfter := reserveQuota(server, targetQuota(server), "target", req.Target, quotaID); !ok {
+		refundQuota(server, senderQuota(server), "sender", req.Sender, quotaID)
+		return fmt.Errorf("<@%s> has taken enough cluebats for now. You can bat them again %s", req.Target, retryWhen(retryAfter))
+	}
+	return nil
+}
+
+// reserveChannel takes a hit in channelID's quota for a bat about to land there
+func reserveChannel(server *SlackServer, channelID string, quotaID string) (bool, time.Duration) {
+	return reserveQuota(server, channelQuota(server), "channel", channelID, quotaID)
+}
+
+func refundChannel(server *SlackServer, channelID string, quotaID string) {
+	refundQuota(server, channelQuota(server), "channel", channelID, quotaID)
+}
+
+// refundBat hands back every hit a bat took. Channel is empty if it never landed
+func refundBat(server *SlackServer, event BatEvent) {
+	if event.QuotaID == "" {
+		return
+	}
+	refundQuota(server, senderQuota(server), "sender", event.Sender, event.QuotaID)
+	refundQuota(server, targetQuota(server), "target", event.Target, event.QuotaID)
+	if event.Channel != "" {
+		refundChannel(server, event.Channel, event.QuotaID)
+	}
+}
+
+func retryWhen(retryAfter time.Duration) string {
+	return fmt.Sprintf("in %s (%s)", retryAfter.Round(time.Second), slackDate(time.Now().Add(retryAfter)))
+}
@@ -0,0 +1,133 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+)
+
+// Role is what a user is allowed to do on a server. Each role can do everything the
+// roles below it can
+type Role int
+
+// Roles, lowest to highest
+const (
+	RoleEveryone Role = iota
+	RoleBatter
+	RoleAdmin
+	RoleOwner
+)
+
+// bannedRole isn't a Role. Being in it denies every command no matter what else you hold
+const bannedRole = "banned"
+
+var roleNames = map[Role]string{
+	RoleEveryone: "everyone",
+	RoleBatter:   "batter",
+	RoleAdmin:    "admin",
+	RoleOwner:    "owner",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// grantableRoles are the names grant and revoke accept
+var grantableRoles = []string{"batter", "admin", "owner", bannedRole}
+
+func isGrantableRole(name string) bool {
+	for _, r := range grantableRoles {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configOwner is whether the config file makes userID an owner
+func (server *SlackServer) configOwner(userID string) bool {
+	for _, owner := range server.Owners {
+		if owner == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func roleKey(server *SlackServer, role string) string {
+	return server.Name + ":role:" + role
+}
+
+// userRole looks up the highest role a user holds on a server and whether they are banned.
+// The server's configured Owners are always owners and can't be banned, so nobody can lock
+// them out from chat
+func userRole(server *SlackServer, userID string) (Role, bool, error) {
+	if server.configOwner(userID) {
+		return RoleOwner, false, nil
+	}
+	banned, err := redis_wrapper.SIsMember(roleKey(server, bannedRole), userID)
+	if err != nil {
+		return RoleEveryone, false, err
+	}
+	for _, role := range []Role{RoleOwner, RoleAdmin, RoleBatter} {
+		ok, err := redis_wrapper.SIsMember(roleKey(server, role.String()), userID)
+		if err != nil {
+			return RoleEveryone, banned, err
+		}
+		if ok {
+			return role, banned, nil
+		}
+	}
+	return RoleEveryone, banned, nil
+}
+
+// userRoleNames lists every role a user has been granted, banned included
+func userRoleNames(server *SlackServer, userID string) ([]string, error) {
+	var names []string
+	if server.configOwner(userID) {
+		names = append(names, "owner (config)")
+	}
+	for _, role := range grantableRoles {
+		ok, err := redis_wrapper.SIsMember(roleKey(server, role), userID)
+		if err != nil {
+			return names, err
+		}
+		if ok {
+			names = append(names, role)
+		}
+	}
+	return names, nil
+}
+
+func grantRole(server *SlackServer, userID string, role string) error {
+	return redis_wrapper.SAdd(roleKey(server, role), userID)
+}
+
+func revokeRole(server *SlackServer, userID string, role string) error {
+	return redis_wrapper.SRem(roleKey(server, role), userID)
+}
+
+// authorize checks the sender may run cmd. If not, the returned string is the polite
+// explanation to send back
+func authorize(server *SlackServer, userID string, cmd *Command) (bool, string, error) {
+	role, banned, err := userRole(server, userID)
+	if err != nil {
+		return false, "Sorry, I couldn't check your permissions just now. Try again in a bit.", err
+	}
+	if banned {
+		return false, fmt.Sprintf("Sorry <@%s>, you've been banned from using cluebatbot here.", userID), nil
+	}
+	if role < cmd.Role {
+		return false, fmt.Sprintf("Sorry <@%s>, `%s` needs the %s role and you don't have it. An owner can `grant` it to you.",
+			userID, cmd.Name, cmd.Role), nil
+	}
+	return true, "", nil
+}
+
+func formatRoleList(names []string) string {
+	if len(names) == 0 {
+		return "no roles"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,59 @@
+package cslack
+
+import (
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// runCommand routes text from user as if it came in a channel and returns the replies
+func runCommand(t *testing.T, server *SlackServer, user string, text string) []string {
+	t.Helper()
+	var replies []string
+	var ev slack.MessageEvent
+	ev.Channel = "C1"
+	ev.User = user
+	ev.Text = text
+	reply := func(msg string, blocks []slack.Block) error {
+		replies = append(replies, msg)
+		return nil
+	}
+	if !routeCommand(ev, nil, server, reply) {
+		t.Fatalf("%q wasn't routed as a command", text)
+	}
+	return replies
+}
+
+func TestOwnersCantDemoteEachOther(t *testing.T) {
+	testRedis(t)
+	server := testServer("roles", "BOT1", "TEAM1")
+	server.Owners = []string{"UCONFIG"}
+
+	runCommand(t, server, "UCONFIG", "grant <@UA> owner")
+	runCommand(t, server, "UCONFIG", "grant <@UB> owner")
+
+	// revoke then ban used to get around the ban check
+	runCommand(t, server, "UA", "revoke <@UB> owner")
+	runCommand(t, server, "UA", "grant <@UB> banned")
+	role, banned, err := userRole(server, "UB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != RoleOwner || banned {
+		t.Fatalf("after another owner's revoke and ban, UB is %s (banned %v), want an unbanned owner", role, banned)
+	}
+
+	// config owners still can
+	runCommand(t, server, "UCONFIG", "revoke <@UB> owner")
+	runCommand(t, server, "UCONFIG", "grant <@UB> banned")
+	if role, banned, _ := userRole(server, "UB"); role == RoleOwner || !banned {
+		t.Errorf("after a config owner's revoke and ban, UB is %s (banned %v), want a banned non-owner", role, banned)
+	}
+
+	// and nobody can touch the config owner
+	runCommand(t, server, "UA", "grant <@UCONFIG> banned")
+	runCommand(t, server, "UA", "revoke <@UCONFIG> owner")
+	if role, banned, _ := userRole(server, "UCONFIG"); role != RoleOwner || banned {
+		t.Errorf("config owner is %s (banned %v), want an unbanned owner", role, banned)
+	}
+}
@@ -0,0 +1,266 @@
+package cslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+const (
+	schedulerInterval   = 5 * time.Second
+	maxPendingPerSender = 10
+	maxScheduleAhead    = 30 * 24 * time.Hour
+	// a bat that fails for a passing reason is put back, a minute later then doubling each
+	// try, until it has had maxScheduledAttempts
+	scheduledRetryDelay  = time.Minute
+	maxScheduledAttempts = 5
+)
+
+// scheduledBat is a bat waiting in redis for its due time
+type scheduledBat struct {
+	ID      string     `json:"ID"`
+	Request batRequest `json:"Request"`
+	Due     time.Time  `json:"Due"`
+	// Attempts counts the deliveries that failed for a passing reason
+	Attempts int `json:"Attempts,omitempty"`
+}
+
+// Scheduled bats live in one sorted set per server, json scored by due unix time. That
+// keeps them across restarts and lets whichever pod ZREMs a job first own delivering it
+func scheduleKey(server *SlackServer) string {
+	return server.Name + ":scheduled"
+}
+
+func scheduleBat(server *SlackServer, req batRequest, due time.Time) (scheduledBat, error) {
+	pending, err := pendingBats(server, req.Sender)
+	if err != nil {
+		return scheduledBat{}, err
+	}
+	if len(pending) >= maxPendingPerSender {
+		return scheduledBat{}, fmt.Errorf("you already have %d cluebats waiting. `cancel` some first", len(pending))
+	}
+	next, err := redis_wrapper.Incr(scheduleKey(server) + ":nextid")
+	if err != nil {
+		return scheduledBat{}, err
+	}
+	job := scheduledBat{ID: strconv.Itoa(next), Request: req, Due: due}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return job, err
+	}
+	return job, redis_wrapper.ZAdd(scheduleKey(server), due.Unix(), string(data))
+}
+
+// allScheduled gets the raw members with their decoded jobs, soonest first
+func allScheduled(server *SlackServer, max string) ([]string, []scheduledBat, error) {
+	members, err := redis_wrapper.ZRangeByScore(scheduleKey(server), "-inf", max)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw []string
+	var jobs []scheduledBat
+	for _, member := range members {
+		var job scheduledBat
+		if err := json.Unmarshal([]byte(member), &job); err != nil {
+			glog.Errorf("%s dropping unreadable scheduled bat: %s", server.Name, err)
+			redis_wrapper.ZRem(scheduleKey(server), member)
+			continue
+		}
+		raw = append(raw, member)
+		jobs = append(jobs, job)
+	}
+	return raw, jobs, nil
+}
+
+// pendingBats lists the bats sender has waiting, soonest first
+func pendingBats(server *SlackServer, sender string) ([]scheduledBat, error) {
+	_, jobs, err := allScheduled(server, "+inf")
+	if err != nil {
+		return nil, err
+	}
+	var mine []scheduledBat
+	for _, job := range jobs {
+		if job.Request.Sender == sender {
+			mine = append(mine, job)
+		}
+	}
+	sort.Slice(mine, func(i, j int) bool { return mine[i].Due.Before(mine[j].Due) })
+	return mine, nil
+}
+
+// cancelBat removes sender's pending bat with id. False means there was no such bat
+func cancelBat(server *SlackServer, sender string, id string) (bool, error) {
+	raw, jobs, err := allScheduled(server, "+inf")
+	if err != nil {
+		return false, err
+	}
+	for i, job := range jobs {
+		if job.ID == id && job.Request.Sender == sender {
+			return redis_wrapper.ZRem(scheduleKey(server), raw[i])
+		}
+	}
+	return false, nil
+}
+
+// runScheduler delivers scheduled bats as they come due. It runs for the life of the
+// server manager
+func runScheduler(slackAPI *slack.Client, server *SlackServer) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if isLeader() {
+			deliverDueBats(slackAPI, server)
+		}
+	}
+}
+
+func deliverDueBats(slackAPI *slack.Client, server *SlackServer) {
+	raw, jobs, err := allScheduled(server, strconv.FormatInt(time.Now().Unix(), 10))
+	if err != nil {
+		glog.Errorf("%s error checking for due bats: %s", server.Name, err)
+		return
+	}
+	for i, job := range jobs {
+		// whoever removes the job gets to deliver it, so replicas can't double up
+		claimed, err := redis_wrapper.ZRem(scheduleKey(server), raw[i])
+		if err != nil {
+			glog.Errorf("%s error claiming scheduled bat %s: %s", server.Name, job.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if *debugCSlack {
+			glog.Infof("%s delivering scheduled bat %s on %s", server.Name, job.ID, job.Request.Target)
+		}
+		msg := ""
+		allowed, why, err := scheduledBatAllowed(server, job.Request.Sender)
+		var event BatEvent
+		if err == nil && allowed {
+			event, err = deliverClueBat(slackAPI, server, job.Request)
+		}
+		switch {
+		case err != nil && !permanentBatFailure(err) && retryScheduled(server, job, err):
+			continue
+		case err != nil:
+			msg = fmt.Sprintf("your scheduled cluebat on <@%s> didn't go out: %s", job.Request.Target, err)
+		case !allowed:
+			msg = fmt.Sprintf("your scheduled cluebat on <@%s> didn't go out: %s", job.Request.Target, why)
+		default:
+			msg = fmt.Sprintf("your scheduled cluebat hit <@%s> in <#%s> %s", event.Target, event.Channel, slackDate(event.Timestamp))
+		}
+		if err := sendDirectMessage(slackAPI, server, job.Request.Sender, msg); err != nil {
+			glog.Errorf("%s error telling %s about scheduled bat %s: %s", server.Name, job.Request.Sender, job.ID, err)
+		}
+	}
+}
+
+// scheduledBatAllowed checks the sender may still bat when a scheduled bat comes due.
+// They were allowed when they scheduled it, but may have lost the role or been banned since.
+// An error means it couldn't tell
+func scheduledBatAllowed(server *SlackServer, sender string) (bool, string, error) {
+	cmd, ok := LookupCommand("bat")
+	if !ok {
+		return true, "", nil
+	}
+	if !cmd.Enabled(server) {
+		return false, "`bat` is turned off on this server", nil
+	}
+	allowed, why, err := authorize(server, sender, cmd)
+	if err != nil {
+		glog.Errorf("%s error checking roles for %s: %s", server.Name, sender, err)
+		return false, "", fmt.Errorf("I couldn't check your permissions just now")
+	}
+	return allowed, why, nil
+}
+
+// permanentBatFailure is whether trying err's bat again later would go the same way
+func permanentBatFailure(err error) bool {
+	switch err.(type) {
+	case optedOutError, noChannelError:
+		return true
+	}
+	return false
+}
+
+// retryScheduled puts job back to try again after a passing failure. False means it has
+// had all its tries, or couldn't be put back
+func retryScheduled(server *SlackServer, job scheduledBat, cause error) bool {
+	if job.Attempts+1 >= maxScheduledAttempts {
+		return false
+	}
+	job.Attempts++
+	job.Due = time.Now().Add(scheduledRetryDelay << uint(job.Attempts-1))
+	data, err := json.Marshal(job)
+	if err == nil {
+		err = redis_wrapper.ZAdd(scheduleKey(server), job.Due.Unix(), string(data))
+	}
+	if err != nil {
+		glog.Errorf("%s error putting back scheduled bat %s: %s", server.Name, job.ID, err)
+		return false
+	}
+	glog.Infof("%s scheduled bat %s failed (%s), trying again %s", server.Name, job.ID, cause, slackDate(job.Due))
+	return true
+}
+
+// parseBatTime reads the `in 2h` or `at 17:00` part of a bat. loc is used for at times;
+// a time that has already passed today means tomorrow
+func parseBatTime(when string, value string, now time.Time, loc *time.Location) (time.Time, error) {
+	var due time.Time
+	switch strings.ToLower(when) {
+	case "in":
+		d, err := parseBatDuration(value)
+		if err != nil {
+			return due, err
+		}
+		due = now.Add(d)
+	case "at":
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			return due, fmt.Errorf("`%s` isn't a time. Use 24 hour HH:MM, like 17:00", value)
+		}
+		local := now.In(loc)
+		due = time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+	default:
+		return due, fmt.Errorf("say `in 2h` or `at 17:00`, not `%s`", when)
+	}
+	if due.Sub(now) > maxScheduleAhead {
+		return due, fmt.Errorf("that's too far away. I only keep grudges for %d days", int(maxScheduleAhead.Hours()/24))
+	}
+	return due, nil
+}
+
+// parseBatDuration is time.ParseDuration plus a d suffix for days
+func parseBatDuration(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("`%s` isn't a duration. Try something like 30m, 2h or 1d", value)
+	}
+	return d, nil
+}
+
+// userLocation is the sender's slack timezone, falling back to UTC
+func userLocation(server *SlackServer, userID string) *time.Location {
+	if user, ok := server.directory().User(userID); ok && user.TZ != "" {
+		if loc, err := time.LoadLocation(user.TZ); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
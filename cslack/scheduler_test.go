@@ -0,0 +1,127 @@
+package cslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/nlopes/slack"
+)
+
+// fakeSlack rate limits users.conversations and records the DMs it's asked to post
+type fakeSlack struct {
+	mu  sync.Mutex
+	dms []string
+}
+
+func (f *fakeSlack) start(t *testing.T) *slack.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users.conversations", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/im.open", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok": true, "channel": {"id": "D1"}}`)
+	})
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		f.dms = append(f.dms, r.Form.Get("text"))
+		f.mu.Unlock()
+		fmt.Fprint(w, `{"ok": true, "channel": "D1", "ts": "1.000001"}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func (f *fakeSlack) takeDMs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dms := f.dms
+	f.dms = nil
+	return dms
+}
+
+// queueDue adds a job that is already due
+func queueDue(t *testing.T, server *SlackServer, job scheduledBat) {
+	t.Helper()
+	job.Due = time.Now().Add(-time.Second)
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redis_wrapper.ZAdd(scheduleKey(server), job.Due.Unix(), string(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverDueBatsKeepsJobsThroughPassingFailures(t *testing.T) {
+	mr := testRedis(t)
+	server := testServer("sched", "BOT1", "TEAM1")
+	fake := &fakeSlack{}
+	slackAPI := fake.start(t)
+	if err := grantRole(server, "USENDER", RoleBatter.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := optOut(server, "UOPTED"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		job   scheduledBat
+		setup func()
+		// retried is whether the job should be put back, otherwise dropped with a DM saying dm
+		retried bool
+		dm      string
+	}{
+		{name: "slack rate limit", job: scheduledBat{ID: "1", Request: batRequest{Sender: "USENDER", Target: "UTARGET"}},
+			retried: true},
+		{name: "roles unreadable", job: scheduledBat{ID: "2", Request: batRequest{Sender: "USENDER", Target: "UTARGET"}},
+			setup: func() { mr.Set(roleKey(server, bannedRole), "not a set") }, retried: true},
+		{name: "last try", job: scheduledBat{ID: "3", Request: batRequest{Sender: "USENDER", Target: "UTARGET"}, Attempts: maxScheduledAttempts - 1},
+			dm: "slow down"},
+		{name: "opted out", job: scheduledBat{ID: "4", Request: batRequest{Sender: "USENDER", Target: "UOPTED"}},
+			dm: "opted out"},
+		{name: "banned", job: scheduledBat{ID: "5", Request: batRequest{Sender: "USENDER", Target: "UTARGET"}},
+			setup: func() { grantRole(server, "USENDER", bannedRole) }, dm: "banned"},
+	}
+	for _, tt := range tests {
+		mr.Del(roleKey(server, bannedRole))
+		if tt.setup != nil {
+			tt.setup()
+		}
+		queueDue(t, server, tt.job)
+		deliverDueBats(slackAPI, server)
+
+		mr.Del(roleKey(server, bannedRole))
+		jobs, err := pendingBats(server, "USENDER")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dms := fake.takeDMs()
+		if tt.retried {
+			if len(jobs) != 1 || jobs[0].Attempts != tt.job.Attempts+1 || !jobs[0].Due.After(time.Now()) {
+				t.Errorf("%s: pending bats are %+v, want it put back for later", tt.name, jobs)
+			}
+			if len(dms) != 0 {
+				t.Errorf("%s: sender was told %q about a bat that will be retried", tt.name, dms)
+			}
+		} else {
+			if len(jobs) != 0 {
+				t.Errorf("%s: the bat is still pending: %+v", tt.name, jobs)
+			}
+			if len(dms) != 1 || !strings.Contains(dms[0], "didn't go out") || !strings.Contains(dms[0], tt.dm) {
+				t.Errorf("%s: sender was told %q, want one DM mentioning %q", tt.name, dms, tt.dm)
+			}
+		}
+		mr.Del(scheduleKey(server))
+	}
+}
@@ -2,62 +2,44 @@ package cslack
 
 import (
 	"fmt"
-	"strconv"
+	"time"
 
-	"github.com/craigske/cluebatbot/redis_wrapper"
-	"github.com/golang/glog"
 	"github.com/nlopes/slack"
 )
 
-func getSlackUsers(slackAPI *slack.Client, server *SlackServer) {
-	var counter int
-	users, err := slackAPI.GetUsers()
+// slackDate formats a time so each reader sees it in their own timezone
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format("2006-01-02 15:04 MST"))
+}
+
+// sendDirectMessage DMs msg to userID
+func sendDirectMessage(slackAPI *slack.Client, server *SlackServer, userID string, msg string) error {
+	_, _, channelID, err := slackAPI.OpenIMChannel(userID)
 	if err != nil {
-		glog.Errorln("Error initializing slack users")
+		countSlackError(server, "im.open")
+		return fmt.Errorf("error opening a DM with %s: %s", userID, err)
 	}
-	// prints the range of users we just snarfed
-	for index, user := range users {
-		counter++
-		if *debugCSlack {
-			glog.Infoln(server.Name + " found " + strconv.Itoa(index) + " is " + user.ID + " name:" + user.Name + " realname: " + user.Profile.RealName + " email: " + user.Profile.Email)
-		}
-		//add to map
-		server.Users[user.ID] = user
-		// Already in redis?
-		exists, err := redis_wrapper.Exists(server.Name + ":user:" + user.ID)
-		if err != nil {
-			glog.Errorf("%s redis Exists Err", server.Name)
-		}
-		if !exists {
-			stringUser := fmt.Sprintf("%#v", user)
-			redis_wrapper.Set(server.Name+":user:"+user.ID, []byte(stringUser))
+	_, _, err = sendSlackMessage(slack.MessageEvent{}, msg, channelID, *slackAPI, server)
+	return err
+}
+
+// dmOwners DMs msg to every owner in the config. It keeps going past a failed DM and
+// returns the last error
+func dmOwners(slackAPI *slack.Client, server *SlackServer, msg string) error {
+	var lastErr error
+	for _, owner := range server.Owners {
+		if err := sendDirectMessage(slackAPI, server, owner, msg); err != nil {
+			lastErr = err
 		}
 	}
-	glog.Infof("%s added %d users\n", server.Name, counter)
+	return lastErr
 }
 
-func getSlackChannels(slackAPI *slack.Client, server *SlackServer) {
-	var counter int
-	channels, err := slackAPI.GetChannels(false)
-	if err != nil {
-		glog.Errorf("%s\n", err)
-		return
-	}
-	for index, channel := range channels {
-		counter++
-		if *debugCSlack {
-			glog.Infoln(server.Name + " found " + strconv.Itoa(index) + " is " + channel.ID + " name:" + channel.Name)
-		}
-		server.Channels[channel.ID] = channel
-		// Already in redis?
-		exists, err := redis_wrapper.Exists(server.Name + ":channel:" + channel.ID)
-		if err != nil {
-			glog.Errorf("%s redis Exists Err", server.Name)
-		}
-		if !exists {
-			stringChannel := fmt.Sprintf("%#v", channel)
-			redis_wrapper.Set(server.Name+":channel:"+channel.ID, []byte(stringChannel))
-		}
+// tellOwners posts msg to the control channel, or DMs the owners if there isn't one
+func tellOwners(slackAPI *slack.Client, server *SlackServer, msg string) error {
+	if server.CluebatBotChan == "" {
+		return dmOwners(slackAPI, server, msg)
 	}
-	glog.Infof("%s added %d channels\n", server.Name, counter)
+	_, _, err := sendSlackMessage(slack.MessageEvent{}, msg, server.CluebatBotChan, *slackAPI, server)
+	return err
 }
@@ -0,0 +1,176 @@
+package cslack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nlopes/slack"
+)
+
+// slashInlineWait is how long a slash command gets to answer in the HTTP response itself.
+// Slack gives up at 3 seconds, anything slower goes to the response_url
+const slashInlineWait = 2500 * time.Millisecond
+
+// slashCommandEvent is a slash command that came in over socket mode. It goes through the
+// transport's event channel like everything else
+type slashCommandEvent struct {
+	Command slack.SlashCommand
+}
+
+// CommandsPath is where a server's slash command request URL should point
+func CommandsPath(server *SlackServer) string {
+	return "/slack/commands/" + url.PathEscape(server.Name)
+}
+
+// ephemeralResponse is what we send slack for a slash command. Ephemeral means only the
+// sender sees it, which is the whole point of batting anonymously
+type ephemeralResponse struct {
+	ResponseType string        `json:"response_type"`
+	Text         string        `json:"text"`
+	Blocks       []slack.Block `json:"blocks,omitempty"`
+}
+
+func newEphemeral(msg string, blocks []slack.Block) ephemeralResponse {
+	return ephemeralResponse{ResponseType: "ephemeral", Text: msg, Blocks: blocks}
+}
+
+// slashReplier answers a slash command. The first reply goes back in the HTTP response
+// if it's quick enough and everything after that goes to the response_url
+type slashReplier struct {
+	responseURL string
+	first       chan ephemeralResponse
+	mu          sync.Mutex
+	responded   bool
+}
+
+func (r *slashReplier) reply(msg string, blocks []slack.Block) error {
+	r.mu.Lock()
+	if !r.responded {
+		r.responded = true
+		r.mu.Unlock()
+		r.first <- newEphemeral(msg, blocks)
+		return nil
+	}
+	r.mu.Unlock()
+	return postToResponseURL(r.responseURL, msg, blocks)
+}
+
+// postToResponseURL sends a delayed ephemeral reply to a slash command or button click
+func postToResponseURL(responseURL string, msg string, blocks []slack.Block) error {
+	body, err := json.Marshal(newEphemeral(msg, blocks))
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response_url said %s", resp.Status)
+	}
+	return nil
+}
+
+// registerSlashCommands serves the server's /cluebat endpoint. It needs a SigningSecret
+func registerSlashCommands(slackAPI *slack.Client, server *SlackServer) {
+	httpMux.HandleFunc(CommandsPath(server), func(w http.ResponseWriter, r *http.Request) {
+		serveSlashCommand(w, r, slackAPI, server)
+	})
+	glog.Infof("%s listening for slash commands on %s", server.Name, CommandsPath(server))
+}
+
+func serveSlashCommand(w http.ResponseWriter, r *http.Request, slackAPI *slack.Client, server *SlackServer) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := readVerifiedBody(r, server.SigningSecret)
+	if err != nil {
+		glog.Errorf("%s rejected a slash command: %s", server.Name, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	cmd, err := slack.SlashCommandParse(r)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	replier := &slashReplier{responseURL: cmd.ResponseURL, first: make(chan ephemeralResponse, 1)}
+	done := make(chan struct{})
+	go func() {
+		runSlashCommand(cmd, slackAPI, server, replier.reply)
+		close(done)
+	}()
+
+	response := newEphemeral("", nil)
+	select {
+	case response = <-replier.first:
+	case <-done:
+		select {
+		case response = <-replier.first:
+		default:
+		}
+	case <-time.After(slashInlineWait):
+		replier.mu.Lock()
+		if replier.responded {
+			replier.mu.Unlock()
+			response = <-replier.first
+		} else {
+			replier.responded = true
+			replier.mu.Unlock()
+			response = newEphemeral("swinging...", nil)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// runSlashCommand puts a slash command through the same router as chat messages. The
+// text is what came after /cluebat, so `/cluebat bat @user` runs bat
+func runSlashCommand(cmd slack.SlashCommand, slackAPI *slack.Client, server *SlackServer, reply replyFunc) {
+	text := strings.TrimSpace(cmd.Text)
+	if text == "" {
+		text = "help"
+	}
+	ev := slack.MessageEvent{Msg: slack.Msg{
+		Type:    "message",
+		Channel: cmd.ChannelID,
+		User:    cmd.UserID,
+		Text:    escapeMentions(text, server),
+		Team:    cmd.TeamID,
+	}}
+	if *debugCSlack {
+		glog.Infof("%s slash command %s from %s: %s", server.Name, cmd.Command, cmd.UserID, ev.Msg.Text)
+	}
+	if !routeCommand(ev, slackAPI, server, reply) {
+		if err := reply(fmt.Sprintf("I don't know how to `%s`. Try `%s help`", text, cmd.Command), nil); err != nil {
+			glog.Errorf("%s error answering slash command from %s: %s", server.Name, cmd.UserID, err)
+		}
+	}
+}
+
+var plainMention = regexp.MustCompile(`(^|\s)@[a-z0-9._-]+`)
+
+// escapeMentions turns plain @name words into <@U123> mentions. Slash command text only
+// has escaped mentions if the app has "Escape channels, users, and links" turned on
+func escapeMentions(text string, server *SlackServer) string {
+	return plainMention.ReplaceAllStringFunc(text, func(match string) string {
+		at := strings.IndexByte(match, '@')
+		if user, ok := server.directory().UserByName(match[at+1:]); ok {
+			return match[:at] + "<@" + user.ID + ">"
+		}
+		return match
+	})
+}
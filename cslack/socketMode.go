@@ -0,0 +1,219 @@
+package cslack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+)
+
+const (
+	defaultSlackAPIURL    = "https://slack.com/api/"
+	maxSocketModeBackoff  = 2 * time.Minute
+	socketModeOpenTimeout = 10 * time.Second
+)
+
+// socketModeEnvelope is the wrapper around everything sent over a socket mode connection
+type socketModeEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Reason     string          `json:"reason"`
+}
+
+// socketModeAck tells slack an envelope arrived. Payload is only used by envelopes that
+// accept a response, like slash commands
+type socketModeAck struct {
+	EnvelopeID string      `json:"envelope_id"`
+	Payload    interface{} `json:"payload,omitempty"`
+}
+
+// socketModeTransport gets events over a websocket the bot opens itself, so it works from
+// behind a firewall with no public ingress
+type socketModeTransport struct {
+	server      *SlackServer
+	openURL     string
+	events      chan slack.RTMEvent
+	connections int
+	// writeMu guards writes to conn, acks can come from more than one goroutine
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+}
+
+func newSocketModeTransport(server *SlackServer) (*socketModeTransport, error) {
+	if !strings.HasPrefix(server.AppToken, "xapp-") {
+		return nil, fmt.Errorf("%s uses the socket transport but has no xapp- AppToken", server.Name)
+	}
+	apiURL := server.SlackAPIURL
+	if apiURL == "" {
+		apiURL = defaultSlackAPIURL
+	}
+	return &socketModeTransport{
+		server:  server,
+		openURL: strings.TrimSuffix(apiURL, "/") + "/apps.connections.open",
+		events:  make(chan slack.RTMEvent, eventQueueSize),
+	}, nil
+}
+
+func (t *socketModeTransport) Start() error {
+	go t.run()
+	return nil
+}
+
+func (t *socketModeTransport) Events() <-chan slack.RTMEvent {
+	return t.events
+}
+
+func (t *socketModeTransport) Shared() bool {
+	return false
+}
+
+// run keeps a connection open, backing off between failed attempts
+func (t *socketModeTransport) run() {
+	backoff := time.Second
+	for {
+		err := t.connectAndRead()
+		if err == nil {
+			backoff = time.Second
+			continue
+		}
+		glog.Errorf("%s socket mode connection failed, retrying in %s: %s", t.server.Name, backoff, err)
+		t.events <- slack.RTMEvent{Type: "disconnected", Data: &slack.DisconnectedEvent{Intentional: false, Cause: err}}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxSocketModeBackoff {
+			backoff = maxSocketModeBackoff
+		}
+	}
+}
+
+// openConnection asks slack for a fresh websocket url
+func (t *socketModeTransport) openConnection() (string, error) {
+	req, err := http.NewRequest(http.MethodPost, t.openURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.server.AppToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := http.Client{Timeout: socketModeOpenTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var opened struct {
+		OK    bool   `json:"ok"`
+		URL   string `json:"url"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&opened); err != nil {
+		return "", fmt.Errorf("bad apps.connections.open response: %s", err)
+	}
+	if !opened.OK {
+		return "", fmt.Errorf("apps.connections.open failed: %s", opened.Error)
+	}
+	return opened.URL, nil
+}
+
+// connectAndRead holds one connection until slack asks us to go away (nil error) or it
+// breaks (error)
+func (t *socketModeTransport) connectAndRead() error {
+	wsURL, err := t.openConnection()
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	t.conn = conn
+	t.writeMu.Unlock()
+	defer func() {
+		t.writeMu.Lock()
+		t.conn = nil
+		t.writeMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var envelope socketModeEnvelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return err
+		}
+		if envelope.EnvelopeID != "" {
+			if err := t.ack(envelope.EnvelopeID, nil); err != nil {
+				return err
+			}
+		}
+		switch envelope.Type {
+		case "hello":
+			glog.Infof("%s socket mode connected", t.server.Name)
+			t.events <- slack.RTMEvent{Type: "connected", Data: &slack.ConnectedEvent{
+				ConnectionCount: t.connections,
+				Info:            &slack.Info{User: &slack.UserDetails{ID: t.server.botID()}, Team: &slack.Team{ID: t.server.teamID()}},
+			}}
+			t.connections++
+		case "disconnect":
+			glog.Infof("%s socket mode asked to reconnect: %s", t.server.Name, envelope.Reason)
+			return nil
+		case "events_api":
+			t.queue(envelope)
+		case "slash_commands":
+			var cmd slack.SlashCommand
+			if err := json.Unmarshal(envelope.Payload, &cmd); err != nil {
+				glog.Errorf("%s bad slash command in %s: %s", t.server.Name, envelope.EnvelopeID, err)
+				continue
+			}
+			t.events <- slack.RTMEvent{Type: "slash_command", Data: &slashCommandEvent{Command: cmd}}
+		case "interactive":
+			var callback slack.InteractionCallback
+			if err := json.Unmarshal(envelope.Payload, &callback); err != nil {
+				glog.Errorf("%s bad interaction in %s: %s", t.server.Name, envelope.EnvelopeID, err)
+				continue
+			}
+			t.events <- slack.RTMEvent{Type: "interactive", Data: &interactionEvent{Callback: callback}}
+		default:
+			if *debugCSlack {
+				glog.Infof("%s ignoring socket mode %s envelope", t.server.Name, envelope.Type)
+			}
+		}
+	}
+}
+
+func (t *socketModeTransport) ack(envelopeID string, payload interface{}) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if t.conn == nil {
+		return errors.New("not connected")
+	}
+	return t.conn.WriteJSON(socketModeAck{EnvelopeID: envelopeID, Payload: payload})
+}
+
+// queue decodes an events_api envelope, whose payload is exactly what the HTTP Events
+// API would have POSTed, and hands it to the server manager
+func (t *socketModeTransport) queue(envelope socketModeEnvelope) {
+	var callback eventsAPIEnvelope
+	if err := json.Unmarshal(envelope.Payload, &callback); err != nil {
+		glog.Errorf("%s bad socket mode payload in %s: %s", t.server.Name, envelope.EnvelopeID, err)
+		return
+	}
+	ev, err := decodeEventsAPIEvent(callback)
+	if err != nil {
+		if *debugCSlack {
+			glog.Infof("%s skipping event %s: %s", t.server.Name, callback.EventID, err)
+		}
+		return
+	}
+	select {
+	case t.events <- ev:
+	default:
+		glog.Errorf("%s event queue full, dropping %s event %s", t.server.Name, ev.Type, callback.EventID)
+	}
+}
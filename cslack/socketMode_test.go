@@ -0,0 +1,109 @@
+package cslack
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/craigske/cluebatbot/cslack/sockettest"
+	"github.com/nlopes/slack"
+)
+
+// nextEvent waits for the transport's next event
+func nextEvent(t *testing.T, tr Transport) slack.RTMEvent {
+	t.Helper()
+	select {
+	case ev := <-tr.Events():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return slack.RTMEvent{}
+}
+
+func expectAck(t *testing.T, fake *sockettest.Server, envelopeID string) {
+	t.Helper()
+	select {
+	case got := <-fake.Acks():
+		if got != envelopeID {
+			t.Fatalf("acked %q, want %q", got, envelopeID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("envelope %s was never acked", envelopeID)
+	}
+}
+
+func expectConnected(t *testing.T, tr Transport) *slack.ConnectedEvent {
+	t.Helper()
+	ev := nextEvent(t, tr)
+	connected, ok := ev.Data.(*slack.ConnectedEvent)
+	if !ok {
+		t.Fatalf("got %T, want *slack.ConnectedEvent", ev.Data)
+	}
+	return connected
+}
+
+func TestSocketModeTransport(t *testing.T) {
+	fake := sockettest.NewServer()
+	defer fake.Close()
+
+	server := testServer("socket", "BOT1", "TEAM1")
+	server.Transport = TransportSocket
+	server.AppToken = "xapp-test"
+	server.SlackAPIURL = fake.APIURL
+	tr, err := newTransport(nil, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if first := expectConnected(t, tr); first.ConnectionCount != 0 {
+		t.Errorf("first connection count = %d, want 0", first.ConnectionCount)
+	}
+
+	id, err := fake.SendEvent("TEAM1", json.RawMessage(`{"type":"message","channel":"C1","user":"U1","text":"bat <@U2>","ts":"1.000001"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAck(t, fake, id)
+	ev := nextEvent(t, tr)
+	msg, ok := ev.Data.(*slack.MessageEvent)
+	if !ok {
+		t.Fatalf("got %T, want *slack.MessageEvent", ev.Data)
+	}
+	if msg.Team != "TEAM1" || msg.Channel != "C1" || msg.Text != "bat <@U2>" {
+		t.Errorf("message = %+v, want team TEAM1 in C1 saying bat <@U2>", msg.Msg)
+	}
+
+	id, err = fake.SendSlashCommand("TEAM1", "C1", "U1", "bat <@U2>", "https://example.com/respond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAck(t, fake, id)
+	ev = nextEvent(t, tr)
+	cmd, ok := ev.Data.(*slashCommandEvent)
+	if !ok {
+		t.Fatalf("got %T, want *slashCommandEvent", ev.Data)
+	}
+	if cmd.Command.UserID != "U1" || cmd.Command.Text != "bat <@U2>" {
+		t.Errorf("slash command = %+v, want U1 saying bat <@U2>", cmd.Command)
+	}
+
+	if err := fake.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if second := expectConnected(t, tr); second.ConnectionCount != 1 {
+		t.Errorf("second connection count = %d, want 1", second.ConnectionCount)
+	}
+
+	// the new connection carries events too
+	id, err = fake.SendEvent("TEAM1", json.RawMessage(`{"type":"message","channel":"C1","user":"U1","text":"again","ts":"2.000001"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAck(t, fake, id)
+	if ev := nextEvent(t, tr); ev.Type != "message" {
+		t.Errorf("got %s after reconnecting, want message", ev.Type)
+	}
+}
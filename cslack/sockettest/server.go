@@ -0,0 +1,165 @@
+// Package sockettest is a fake slack socket mode endpoint for tests and local runs. Point a
+// server's SlackAPIURL at Server.APIURL and give it any xapp- AppToken.
+package sockettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server serves apps.connections.open and the websocket it hands out
+type Server struct {
+	// APIURL is the fake slack API base url
+	APIURL string
+
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+	acks       chan string
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	nextID int
+	ready  chan struct{}
+}
+
+// NewServer starts a fake. Close it when done
+func NewServer() *Server {
+	s := &Server{
+		acks:  make(chan string, 100),
+		ready: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps.connections.open", s.open)
+	mux.HandleFunc("/link", s.link)
+	s.httpServer = httptest.NewServer(mux)
+	s.APIURL = s.httpServer.URL + "/"
+	return s
+}
+
+// Close shuts the fake down
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	s.httpServer.Close()
+}
+
+// Connected is closed once a client has connected and been sent its hello
+func (s *Server) Connected() <-chan struct{} {
+	return s.ready
+}
+
+// Acks gets the envelope id of every ack the client sends
+func (s *Server) Acks() <-chan string {
+	return s.acks
+}
+
+// SendEvent wraps an inner event, like {"type":"message","text":"bat <@U1>",...}, in an
+// events_api envelope and sends it. It returns the envelope id to look for in Acks
+func (s *Server) SendEvent(teamID string, event json.RawMessage) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":    "event_callback",
+		"team_id": teamID,
+		"event":   event,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.send("events_api", payload)
+}
+
+// SendSlashCommand sends a slash_commands envelope, like what slack sends for `/cluebat text`
+func (s *Server) SendSlashCommand(teamID, channelID, userID, text, responseURL string) (string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"command":      "/cluebat",
+		"team_id":      teamID,
+		"channel_id":   channelID,
+		"user_id":      userID,
+		"text":         text,
+		"response_url": responseURL,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.send("slash_commands", payload)
+}
+
+// Disconnect asks the client to reconnect, like slack does before rotating a connection
+func (s *Server) Disconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return fmt.Errorf("no client connected")
+	}
+	return s.conn.WriteJSON(map[string]string{"type": "disconnect", "reason": "refresh_requested"})
+}
+
+func (s *Server) send(envelopeType string, payload json.RawMessage) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return "", fmt.Errorf("no client connected")
+	}
+	s.nextID++
+	id := fmt.Sprintf("envelope-%d", s.nextID)
+	return id, s.conn.WriteJSON(map[string]interface{}{
+		"envelope_id": id,
+		"type":        envelopeType,
+		"payload":     payload,
+	})
+}
+
+func (s *Server) open(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer xapp-") {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not_authed"})
+		return
+	}
+	wsURL := "ws" + strings.TrimPrefix(s.httpServer.URL, "http") + "/link"
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": wsURL})
+}
+
+func (s *Server) link(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	err = conn.WriteJSON(map[string]interface{}{"type": "hello", "num_connections": 1})
+	if err == nil {
+		select {
+		case <-s.ready:
+		default:
+			close(s.ready)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	for {
+		var ack struct {
+			EnvelopeID string `json:"envelope_id"`
+		}
+		if err := conn.ReadJSON(&ack); err != nil {
+			return
+		}
+		select {
+		case s.acks <- ack.EnvelopeID:
+		default:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cslack
+
+import (
+	"sync"
+)
+
+// serverState is what a running server learns and keeps, as opposed to its config. Every
+// SlackServerManager gets its own, so two servers in one process can't trample each other
+type serverState struct {
+	mu     sync.RWMutex
+	botID  string
+	teamID string
+	// directory is set once before any events are handled and never replaced
+	directory *Directory
+	// latency has its own lock
+	latency *latencyTracker
+	// alerts has its own lock
+	alerts *latencyAlerter
+	// conn has its own lock too, the health probes read it
+	conn connState
+}
+
+func newServerState(server *SlackServer, botID string, teamID string) *serverState {
+	return &serverState{
+		botID:     botID,
+		teamID:    teamID,
+		directory: newDirectory(server),
+		latency:   newLatencyTracker(server.LatencyWindow),
+		alerts:    newLatencyAlerter(server),
+	}
+}
+
+func (s *serverState) setIdentity(botID string, teamID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.botID = botID
+	s.teamID = teamID
+}
+
+// botID is the bot's own user id on this server
+func (server *SlackServer) botID() string {
+	server.state.mu.RLock()
+	defer server.state.mu.RUnlock()
+	return server.state.botID
+}
+
+// teamID is the workspace this server is connected to
+func (server *SlackServer) teamID() string {
+	server.state.mu.RLock()
+	defer server.state.mu.RUnlock()
+	return server.state.teamID
+}
+
+// directory is the server's users and channels
+func (server *SlackServer) directory() *Directory {
+	return server.state.directory
+}
@@ -0,0 +1,93 @@
+package cslack
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/nlopes/slack"
+)
+
+func testServer(name string, botID string, teamID string) *SlackServer {
+	server := &SlackServer{Name: name, LatencyWindow: 10}
+	server.state = newServerState(server, botID, teamID)
+	return server
+}
+
+// testRedis points redis_wrapper at a fresh in-memory redis for the rest of the test
+func testRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis_wrapper.Configure(mr.Addr(), "")
+	t.Cleanup(mr.Close)
+	return mr
+}
+
+// TestServerStateConcurrent runs two servers' state from many goroutines at once, the way
+// the event loop, slash commands, interactions, the scheduler and the directory refresh
+// do. Run it with -race
+func TestServerStateConcurrent(t *testing.T) {
+	servers := []*SlackServer{
+		testServer("one", "BOT1", "TEAM1"),
+		testServer("two", "BOT2", "TEAM2"),
+	}
+
+	var wg sync.WaitGroup
+	for n, server := range servers {
+		botID := fmt.Sprintf("BOT%d", n+1)
+		teamID := fmt.Sprintf("TEAM%d", n+1)
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(server *SlackServer, g int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					switch g {
+					case 0:
+						server.state.setIdentity(botID, teamID)
+						server.state.conn.set(connConnected)
+					case 1:
+						if got := server.botID(); got != botID {
+							t.Errorf("%s botID = %q, want %q", server.Name, got, botID)
+						}
+						if got := server.teamID(); got != teamID {
+							t.Errorf("%s teamID = %q, want %q", server.Name, got, teamID)
+						}
+						server.state.conn.get()
+					case 2:
+						user := slack.User{ID: fmt.Sprintf("U%d", i), Name: server.Name + "-user"}
+						server.directory().applyEvent(&slack.UserChangeEvent{User: user})
+						server.directory().User(user.ID)
+						server.directory().UserByName(user.Name)
+					case 3:
+						server.state.latency.add(time.Duration(i) * time.Millisecond)
+						server.state.latency.stats()
+					}
+				}
+			}(server, g)
+		}
+	}
+	wg.Wait()
+
+	for n, server := range servers {
+		want := fmt.Sprintf("BOT%d", n+1)
+		if got := server.botID(); got != want {
+			t.Errorf("%s botID = %q, want %q", server.Name, got, want)
+		}
+		user, ok := server.directory().User("U0")
+		if !ok || user.Name != server.Name+"-user" {
+			t.Errorf("%s directory has %+v, want its own user", server.Name, user)
+		}
+		if stats := server.state.latency.stats(); stats.Count != 10 {
+			t.Errorf("%s latency window has %d samples, want 10", server.Name, stats.Count)
+		}
+		if state, _ := server.state.conn.get(); state != connConnected {
+			t.Errorf("%s connection = %q, want %q", server.Name, state, connConnected)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cslack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/craigske/cluebatbot/redis_wrapper"
+	"github.com/golang/glog"
+)
+
+// BatTemplate is a cluebat message written as a text/template
+type BatTemplate struct {
+	ID   string `json:"ID"`
+	Text string `json:"Text"`
+	// Weight is how likely the template is to be picked relative to the others. 0 counts as 1
+	Weight int      `json:"Weight"`
+	Tags   []string `json:"Tags"`
+}
+
+// BatTemplateData is what a template can use, e.g. "WHAM. {{.Target}}, that's {{.Count}} now"
+type BatTemplateData struct {
+	// Target, Sender and Channel are slack markup so they render as mentions
+	Target  string
+	Sender  string
+	Channel string
+	// Count is how many times the target has been batted, this one included
+	Count int
+}
+
+// builtinTemplates are used until a server adds its own
+var builtinTemplates = []BatTemplate{
+	{ID: "builtin1", Text: "{{.Target}} you've been hit with a cluebat, peon", Tags: []string{"savage"}},
+	{ID: "builtin2", Text: "WHAM. {{.Target}}, you've been nailed with the cluebat. Hopefully it left a lasting impression"},
+	{ID: "builtin3", Text: "SHWOK. {{.Target}}, you've been beaned in the noggin with the cluebat. Hopefully it imparted clue"},
+	{ID: "builtin4", Text: "THWACK. {{.Target}}, you've been hit with the cluebat. Clue imprint attempted", Tags: []string{"gentle"}},
+}
+
+func templatesKey(server *SlackServer) string {
+	return server.Name + ":templates"
+}
+
+func (t BatTemplate) weight() int {
+	if t.Weight <= 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// HasTag reports whether the template is tagged with tag
+func (t BatTemplate) HasTag(tag string) bool {
+	for _, have := range t.Tags {
+		if strings.EqualFold(have, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes the template with data
+func (t BatTemplate) Render(data BatTemplateData) (string, error) {
+	tmpl, err := template.New(t.ID).Option("missingkey=error").Parse(t.Text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// loadTemplates gets a server's templates sorted by id. The bool is true when the server
+// has none of its own and the built-ins were returned
+func loadTemplates(server *SlackServer) ([]BatTemplate, bool, error) {
+	stored, err := redis_wrapper.HGetAll(templatesKey(server))
+	if err != nil {
+		return builtinTemplates, true, err
+	}
+	if len(stored) == 0 {
+		return builtinTemplates, true, nil
+	}
+	templates := make([]BatTemplate, 0, len(stored))
+	for id, data := range stored {
+		var t BatTemplate
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			glog.Errorf("%s skipping unreadable template %s: %s", server.Name, id, err)
+			continue
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templateLess(templates[i].ID, templates[j].ID) })
+	return templates, false, nil
+}
+
+// ids are t1, t2... so sort them by number rather than as strings
+func templateLess(a, b string) bool {
+	an, aErr := strconv.Atoi(strings.TrimPrefix(a, "t"))
+	bn, bErr := strconv.Atoi(strings.TrimPrefix(b, "t"))
+	if aErr == nil && bErr == nil {
+		return an < bn
+	}
+	return a < b
+}
+
+// addTemplate validates and stores a new template, filling in its id
+func addTemplate(server *SlackServer, t BatTemplate) (BatTemplate, error) {
+	if _, err := t.Render(BatTemplateData{Target: "<@U0>", Sender: "<@U0>", Channel: "<#C0>", Count: 1}); err != nil {
+		return t, fmt.Errorf("that template doesn't work: %s", err)
+	}
+	next, err := redis_wrapper.Incr(templatesKey(server) + ":nextid")
+	if err != nil {
+		return t, err
+	}
+	t.ID = "t" + strconv.Itoa(next)
+	data, err := json.Marshal(t)
+	if err != nil {
+		return t, err
+	}
+	return t, redis_wrapper.HSet(templatesKey(server), t.ID, data)
+}
+
+func removeTemplate(server *SlackServer, id string) (bool, error) {
+	return redis_wrapper.HDel(templatesKey(server), id)
+}
+
+// pickTemplate chooses a template by weight, only from those tagged tag if tag is set
+func pickTemplate(templates []BatTemplate, tag string, rng RNG) (BatTemplate, bool) {
+	var pool []BatTemplate
+	total := 0
+	for _, t := range templates {
+		if tag == "" || t.HasTag(tag) {
+			pool = append(pool, t)
+			total += t.weight()
+		}
+	}
+	if len(pool) == 0 {
+		return BatTemplate{}, false
+	}
+	target := int(rng.Float64() * float64(total))
+	for _, t := range pool {
+		if target < t.weight() {
+			return t, true
+		}
+		target -= t.weight()
+	}
+	return pool[len(pool)-1], true
+}
+
+// clueBatMessage renders a cluebat for the server, picking a template tagged tag if given.
+// Anything going wrong falls back to the built-ins so a bat always has something to say
+func clueBatMessage(server *SlackServer, tag string, data BatTemplateData, rng RNG) (string, BatTemplate, error) {
+	templates, _, err := loadTemplates(server)
+	if err != nil {
+		glog.Errorf("%s error loading templates, using the built-ins: %s", server.Name, err)
+	}
+	t, ok := pickTemplate(templates, tag, rng)
+	if !ok {
+		return "", t, fmt.Errorf("there are no templates tagged `%s`", tag)
+	}
+	msg, err := t.Render(data)
+	if err != nil {
+		glog.Errorf("%s template %s failed to render, using a built-in: %s", server.Name, t.ID, err)
+		t, _ = pickTemplate(builtinTemplates, "", rng)
+		msg, err = t.Render(data)
+	}
+	return msg, t, err
+}
@@ -0,0 +1,148 @@
+package cslack
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ArgKind is the type of a parsed command argument
+type ArgKind int
+
+// Arg kinds. ArgAny is only used in an ArgSpec to accept any kind
+const (
+	ArgAny ArgKind = iota
+	ArgText
+	ArgUser
+	ArgChannel
+	ArgSpecial
+	ArgURL
+)
+
+func (k ArgKind) String() string {
+	switch k {
+	case ArgText:
+		return "text"
+	case ArgUser:
+		return "@user"
+	case ArgChannel:
+		return "#channel"
+	case ArgSpecial:
+		return "special mention"
+	case ArgURL:
+		return "link"
+	default:
+		return "anything"
+	}
+}
+
+// Arg is one parsed argument of a command line
+type Arg struct {
+	Kind ArgKind
+	// Raw is the argument exactly as slack sent it, quotes and escapes included
+	Raw string
+	// Value is the user id, channel id, url, special name (here, channel, subteam^S123...)
+	// or the unescaped text of the argument
+	Value string
+	// Label is the text after the | slack adds to some entities, e.g. the name in <#C123|general>
+	Label  string
+	Quoted bool
+}
+
+// ErrUnterminatedQuote is returned by Tokenize when a quoted string is never closed
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// ErrUnterminatedEntity is returned by Tokenize when a <...> entity is never closed
+var ErrUnterminatedEntity = errors.New("unterminated <...> entity")
+
+var slackUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// Tokenize splits slack message text into args. Runs of whitespace (newlines included)
+// separate args, "double quoted" strings become a single text arg, and slack's escaped
+// entities (<@U123|name>, <#C123|name>, <!here>, <http://url|label>) become typed args.
+// On error the args parsed so far are returned
+func Tokenize(text string) ([]Arg, error) {
+	var args []Arg
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				return args, ErrUnterminatedEntity
+			}
+			args = append(args, parseEntity(text[i:i+end+1]))
+			i += end + 1
+		case isOpenQuote(r):
+			start := i + size
+			end := indexCloseQuote(text[start:])
+			if end < 0 {
+				return args, ErrUnterminatedQuote
+			}
+			_, closeSize := utf8.DecodeRuneInString(text[start+end:])
+			raw := text[i : start+end+closeSize]
+			args = append(args, Arg{Kind: ArgText, Raw: raw, Value: slackUnescaper.Replace(text[start : start+end]), Quoted: true})
+			i = start + end + closeSize
+		default:
+			end := strings.IndexFunc(text[i:], func(r rune) bool { return unicode.IsSpace(r) || r == '<' })
+			if end < 0 {
+				end = len(text) - i
+			}
+			raw := text[i : i+end]
+			args = append(args, Arg{Kind: ArgText, Raw: raw, Value: slackUnescaper.Replace(raw)})
+			i += end
+		}
+	}
+	return args, nil
+}
+
+// parseEntity turns a <...> entity into an arg
+func parseEntity(raw string) Arg {
+	arg := Arg{Raw: raw}
+	inner := raw[1 : len(raw)-1]
+	if bar := strings.IndexByte(inner, '|'); bar >= 0 {
+		arg.Label = slackUnescaper.Replace(inner[bar+1:])
+		inner = inner[:bar]
+	}
+	switch {
+	case strings.HasPrefix(inner, "@"):
+		arg.Kind = ArgUser
+		arg.Value = inner[1:]
+	case strings.HasPrefix(inner, "#"):
+		arg.Kind = ArgChannel
+		arg.Value = inner[1:]
+	case strings.HasPrefix(inner, "!"):
+		arg.Kind = ArgSpecial
+		arg.Value = inner[1:]
+	default:
+		arg.Kind = ArgURL
+		arg.Value = slackUnescaper.Replace(inner)
+	}
+	return arg
+}
+
+// slack clients like to turn " into smart quotes, so accept those too
+func isOpenQuote(r rune) bool {
+	return r == '"' || r == '“'
+}
+
+func indexCloseQuote(s string) int {
+	return strings.IndexAny(s, "\"”")
+}
+
+// Text renders args back into a string. Text args give their unescaped value and
+// entities are kept as slack markup so they still render as mentions and links
+func Text(args []Arg) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg.Kind == ArgText {
+			parts = append(parts, arg.Value)
+		} else {
+			parts = append(parts, arg.Raw)
+		}
+	}
+	return strings.Join(parts, " ")
+}
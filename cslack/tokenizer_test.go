@@ -0,0 +1,82 @@
+package cslack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Arg
+		err  error
+	}{
+		{"empty", "  \n ", nil, nil},
+		{"words", "bat  them", []Arg{
+			{Kind: ArgText, Raw: "bat", Value: "bat"},
+			{Kind: ArgText, Raw: "them", Value: "them"},
+		}, nil},
+		{"newlines separate args", "bat\n<@U1>\n\nnow", []Arg{
+			{Kind: ArgText, Raw: "bat", Value: "bat"},
+			{Kind: ArgUser, Raw: "<@U1>", Value: "U1"},
+			{Kind: ArgText, Raw: "now", Value: "now"},
+		}, nil},
+		{"user with a name", "<@U1|craig>", []Arg{
+			{Kind: ArgUser, Raw: "<@U1|craig>", Value: "U1", Label: "craig"},
+		}, nil},
+		{"channel, special and link", "<#C1|general> <!here> <https://x.io/?a=1&amp;b=2|x.io>", []Arg{
+			{Kind: ArgChannel, Raw: "<#C1|general>", Value: "C1", Label: "general"},
+			{Kind: ArgSpecial, Raw: "<!here>", Value: "here"},
+			{Kind: ArgURL, Raw: "<https://x.io/?a=1&amp;b=2|x.io>", Value: "https://x.io/?a=1&b=2", Label: "x.io"},
+		}, nil},
+		{"entity glued to a word", "hi<@U1>", []Arg{
+			{Kind: ArgText, Raw: "hi", Value: "hi"},
+			{Kind: ArgUser, Raw: "<@U1>", Value: "U1"},
+		}, nil},
+		{"unescapes text", "fish &amp; chips &lt;3", []Arg{
+			{Kind: ArgText, Raw: "fish", Value: "fish"},
+			{Kind: ArgText, Raw: "&amp;", Value: "&"},
+			{Kind: ArgText, Raw: "chips", Value: "chips"},
+			{Kind: ArgText, Raw: "&lt;3", Value: "<3"},
+		}, nil},
+		{"straight quotes", `say "fish &amp; chips" now`, []Arg{
+			{Kind: ArgText, Raw: "say", Value: "say"},
+			{Kind: ArgText, Raw: `"fish &amp; chips"`, Value: "fish & chips", Quoted: true},
+			{Kind: ArgText, Raw: "now", Value: "now"},
+		}, nil},
+		{"smart quotes", "say “read the\ndocs”", []Arg{
+			{Kind: ArgText, Raw: "say", Value: "say"},
+			{Kind: ArgText, Raw: "“read the\ndocs”", Value: "read the\ndocs", Quoted: true},
+		}, nil},
+		{"empty quotes", `""`, []Arg{
+			{Kind: ArgText, Raw: `""`, Value: "", Quoted: true},
+		}, nil},
+		{"unterminated quote", `bat "oops`, []Arg{
+			{Kind: ArgText, Raw: "bat", Value: "bat"},
+		}, ErrUnterminatedQuote},
+		{"unterminated smart quote", "“oops", nil, ErrUnterminatedQuote},
+		{"unterminated entity", "bat <@U1", []Arg{
+			{Kind: ArgText, Raw: "bat", Value: "bat"},
+		}, ErrUnterminatedEntity},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.text)
+		if err != tt.err {
+			t.Errorf("%s: Tokenize(%q) error = %v, want %v", tt.name, tt.text, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Tokenize(%q) = %+v, want %+v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	args, err := Tokenize(`"fish &amp; chips" for <@U1|craig>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Text(args), "fish & chips for <@U1|craig>"; got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package cslack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// Transport names for SlackServer.Transport
+const (
+	TransportRTM  = "rtm"
+	TransportHTTP = "http"
+	// TransportSocket is socket mode, for running without public ingress
+	TransportSocket = "socket"
+)
+
+// Transport gets slack events to a server manager. Every transport hands over the same
+// slack.RTMEvent values the RTM produces, so everything after it is shared
+type Transport interface {
+	// Start connects. It must not block
+	Start() error
+	Events() <-chan slack.RTMEvent
+	// Shared is true when every replica gets every event, so only the leader should act.
+	// Slack hands each HTTP request or socket mode envelope to just one replica
+	Shared() bool
+}
+
+// newTransport builds the transport the server's config asks for
+func newTransport(slackAPI *slack.Client, server *SlackServer) (Transport, error) {
+	switch strings.ToLower(server.Transport) {
+	case "", TransportRTM:
+		return &rtmTransport{rtm: slackAPI.NewRTM()}, nil
+	case TransportHTTP:
+		return newHTTPTransport(slackAPI, server)
+	case TransportSocket:
+		return newSocketModeTransport(server)
+	default:
+		return nil, fmt.Errorf("%s has unknown transport %q", server.Name, server.Transport)
+	}
+}
+
+// rtmTransport is the classic RTM websocket
+type rtmTransport struct {
+	rtm *slack.RTM
+}
+
+func (t *rtmTransport) Start() error {
+	go t.rtm.ManageConnection()
+	return nil
+}
+
+func (t *rtmTransport) Events() <-chan slack.RTMEvent {
+	return t.rtm.IncomingEvents
+}
+
+func (t *rtmTransport) Shared() bool {
+	return true
+}
@@ -0,0 +1,45 @@
+package cslack
+
+import (
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// addressedText decides if a message was meant for the bot. DMs always are, as are
+// messages that start with an @mention of the bot or with the server's CommandPrefix.
+// Returns the message text with the mention or prefix stripped off
+func addressedText(ev slack.MessageEvent, server *SlackServer) (string, bool) {
+	text := strings.TrimSpace(ev.Msg.Text)
+	if botID := server.botID(); botID != "" {
+		for _, mention := range []string{"<@" + botID + ">", "<@" + botID + "|"} {
+			if strings.HasPrefix(text, mention) {
+				text = text[len(mention):]
+				if strings.HasSuffix(mention, "|") {
+					end := strings.IndexByte(text, '>')
+					if end < 0 {
+						return "", false
+					}
+					text = text[end+1:]
+				}
+				return strings.TrimLeft(text, " \t\n:,"), true
+			}
+		}
+	}
+	if server.CommandPrefix != "" && strings.HasPrefix(text, server.CommandPrefix) {
+		rest := text[len(server.CommandPrefix):]
+		// "!cb bat" is for us, "!cbat" isn't
+		if rest == "" || strings.TrimLeft(rest, " \t\n") != rest {
+			return strings.TrimSpace(rest), true
+		}
+	}
+	if isDirectMessage(ev.Channel) {
+		return text, true
+	}
+	return "", false
+}
+
+// DM channel ids start with a D, everything else (C for channels, G for groups) doesn't
+func isDirectMessage(channelID string) bool {
+	return strings.HasPrefix(channelID, "D")
+}
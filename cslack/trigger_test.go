@@ -0,0 +1,45 @@
+package cslack
+
+import (
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestAddressedText(t *testing.T) {
+	server := testServer("trigger", "BOT1", "TEAM1")
+	server.CommandPrefix = "!cb"
+
+	tests := []struct {
+		name      string
+		channel   string
+		text      string
+		want      string
+		addressed bool
+	}{
+		{"prefix", "C1", "!cb bat <@U2>", "bat <@U2>", true},
+		{"prefix on its own", "C1", "!cb", "", true},
+		{"prefix then a newline", "C1", "!cb\nhelp", "help", true},
+		{"prefix glued to a word", "C1", "!cbat <@U2>", "", false},
+		{"mention", "C1", "<@BOT1> bat <@U2>", "bat <@U2>", true},
+		{"mention with a colon", "C1", "<@BOT1>: help", "help", true},
+		{"mention with a name", "C1", "<@BOT1|cluebatbot>: help", "help", true},
+		{"broken mention", "C1", "<@BOT1|cluebatbot help", "", false},
+		{"someone else mentioned", "C1", "<@U2> help", "", false},
+		{"mention later on", "C1", "hey <@BOT1> help", "", false},
+		{"chatter", "C1", "just chatting", "", false},
+		{"dm", "D1", "bat <@U2>", "bat <@U2>", true},
+		{"dm with the prefix", "D1", "!cb help", "help", true},
+		{"dm with a mention", "D1", "<@BOT1> help", "help", true},
+	}
+	for _, tt := range tests {
+		var ev slack.MessageEvent
+		ev.Channel = tt.channel
+		ev.Text = tt.text
+		got, addressed := addressedText(ev, server)
+		if got != tt.want || addressed != tt.addressed {
+			t.Errorf("%s: addressedText(%q in %s) = %q, %v, want %q, %v",
+				tt.name, tt.text, tt.channel, got, addressed, tt.want, tt.addressed)
+		}
+	}
+}
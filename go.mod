@@ -4,14 +4,16 @@ go 1.14
 
 require (
 	cloud.google.com/go v0.56.0 // indirect
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/gomodule/redigo v2.0.0+incompatible
-	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/json-iterator/go v1.1.9 // indirect
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/logrusorgru/aurora v0.0.0-20200102142835-e9ef32dff381
 	github.com/nlopes/slack v0.6.0
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_golang v1.5.1
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/sys v0.0.0-20200409092240-59c9f1ba88fa // indirect
 	google.golang.org/api v0.21.0
@@ -21,4 +23,5 @@ require (
 	k8s.io/apimachinery v0.18.1
 	k8s.io/client-go v0.18.1
 	k8s.io/utils v0.0.0-20200410165547-614e4363e9c4 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
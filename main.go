@@ -1,23 +1,24 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/craigske/cluebatbot/config"
 	"github.com/craigske/cluebatbot/cslack"
 	"github.com/craigske/cluebatbot/redis_wrapper"
 	"github.com/golang/glog"
 	"github.com/logrusorgru/aurora"
 	"github.com/nlopes/slack"
-
 	// // may be required later for google API auth
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )
@@ -41,10 +42,12 @@ type SlackServer cslack.SlackServer
 var debug = flag.Bool("debug", true, "enable or disable debug")
 var verbose = flag.Bool("verbose", false, "enable or disable verbose logging")
 var colors = flag.Bool("colors", true, "enable or disable colors")
-var serviceDNS = flag.String("port", "2000", "app port")
-var port = flag.String("serviceDNS", "localhost", "app service DNS name")
-var credsFile = flag.String("credsFile", "./cluebatbot-config.json", "credentials file")
-var makeMasterOnError = flag.Bool("makeMasterOnError", false, "make this node master if unable to connect to the cluster ip provided.")
+var port = flag.String("port", "2000", "app port")
+var serviceDNS = flag.String("serviceDNS", "localhost", "app service DNS name")
+var configFile = flag.String("config", "./cluebatbot-config.json", "config file, YAML or JSON")
+var credsFile = flag.String("credsFile", "", "deprecated, use -config")
+var validateConfig = flag.Bool("validate-config", false, "check the config file, print what's wrong with it and exit")
+var makeMasterOnError = flag.Bool("makeMasterOnError", false, "make this node master if redis can't be reached for leader election.")
 
 // Globals
 var stopChan = make(chan os.Signal, 2)
@@ -53,32 +56,30 @@ var tickCounter = 0
 var users Users
 var channels Channels
 var slackServers []cslack.SlackServer
+var cfg *config.Config
 var runningInK8s bool
 var nodeName string
 
 func init() {
 	flag.Parse()
 	flag.Lookup("logtostderr").Value.Set("true")
+	au = aurora.NewAurora(*colors)
 	glog.Infoln("INIT ClueBatBot")
 
 	writeConfig := os.Getenv("WRITE_EXAMPLE_CONFIG")
 	if writeConfig == "true" {
-		writeExampleCredsFile()
+		writeExampleConfig()
 		glog.Fatalln("Wrote example config. Unset WRITE_EXAMPLE_CONFIG to stop doing this.")
 	}
 
-	readCredsFile() // TODO: refactor to some config system
+	loadConfig()
 
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost:6379"
-	}
 
 	nodeName = os.Getenv("MY_POD_NAME")
 	if len(nodeName) == 0 {
 		rand.Seed(time.Now().UnixNano())
-		nodeName = string(rand.Uint32())
+		nodeName = strconv.FormatUint(uint64(rand.Uint32()), 10)
 	} else {
 		runningInK8s = true
 	}
@@ -92,6 +93,9 @@ func main() {
 		return
 	}
 
+	// only the leader handles events, so replicas can run side by side
+	elector := cslack.StartLeaderElection(nodeName, *makeMasterOnError)
+
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan,
 		syscall.SIGHUP,
@@ -99,17 +103,31 @@ func main() {
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 
+	// events API, /metrics, and anything else cslack serves over HTTP
+	go func() {
+		glog.Infof("Serving HTTP on :%s", cfg.HTTP.Port)
+		err := http.ListenAndServe(":"+cfg.HTTP.Port, cslack.HTTPHandler())
+		glog.Errorf("HTTP server stopped: %s", err)
+	}()
+
 	// initialize a slack server chan for each server
 	for _, server := range slackServers {
 		if *debug {
 			glog.Infof("Creating server named %s \n", server.Name)
 		}
-		currentSlackAPI := slack.New(server.APIKey)
+		var options []slack.Option
+		if server.SlackAPIURL != "" {
+			options = append(options, slack.OptionAPIURL(server.SlackAPIURL))
+		}
+		currentSlackAPI := slack.New(server.APIKey, options...)
 		authTest, err := currentSlackAPI.AuthTest()
 		if err != nil {
 			glog.Infof("Error in auth: %s\n", err)
 			return
 		}
+		if server.Transport == cslack.TransportHTTP {
+			glog.Infof("%s events API request URL is http://%s:%s%s", server.Name, cfg.HTTP.ServiceDNS, cfg.HTTP.Port, cslack.EventsPath(&server))
+		}
 		// start the server manager
 		go cslack.SlackServerManager(currentSlackAPI, server, authTest.UserID, authTest.TeamID)
 	}
@@ -120,68 +138,91 @@ func main() {
 		glog.Errorf("Err getting the singal int value")
 	}
 	glog.Info("Stopping cluebatbot")
+	elector.Stop()
 	glog.Flush()
 	os.Exit(sigInt)
 }
 
-func readCredsFile() {
-	data, err := ioutil.ReadFile(*credsFile)
-	if err != nil {
-		die("failed to open the creds file", err)
+// useCredsFile keeps deployments that still pass the old -credsFile flag starting. It is
+// only used if -config isn't given too
+func useCredsFile() {
+	if *credsFile == "" {
+		return
+	}
+	configSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configSet = true
+		}
+	})
+	if configSet {
+		glog.Warningf("-credsFile is deprecated and ignored since -config is set too")
+		return
 	}
+	glog.Warningf("-credsFile is deprecated, use -config=%s instead", *credsFile)
+	*configFile = *credsFile
+}
 
-	err = json.Unmarshal(data, &slackServers)
+// loadConfig reads the config file and applies it. Flags given on the command line win
+// over the file and the environment
+func loadConfig() {
+	useCredsFile()
+	var err error
+	cfg, err = config.Load(*configFile)
+	if *validateConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is a valid version %d config with %d server(s)\n", *configFile, cfg.Version, len(cfg.Servers))
+		os.Exit(0)
+	}
 	if err != nil {
-		die("failed read slack sever json", err)
+		die("failed to load the config", err)
 	}
-	if *debug {
-		glog.Infof("SlackServers structs: \n%#v", slackServers)
+	if cfg.Version < config.CurrentVersion {
+		glog.Warningf("%s is a version %d config. Run with WRITE_EXAMPLE_CONFIG=true to see version %d", *configFile, cfg.Version, config.CurrentVersion)
 	}
 
-}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.HTTP.Port = *port
+		case "serviceDNS":
+			cfg.HTTP.ServiceDNS = *serviceDNS
+		case "debug":
+			cfg.Logging.Debug = *debug
+		}
+	})
+	*debug = cfg.Logging.Debug
+	if cfg.Logging.Verbosity > 0 {
+		flag.Set("v", strconv.Itoa(cfg.Logging.Verbosity))
+	}
+	if cfg.Logging.CSlackDebug {
+		glog.Infof("init cslack debug on")
+		flag.Set("debugCSlack", "true")
+	}
+	if cfg.Logging.LatencyTick {
+		flag.Set("debugLatencyTick", "true")
+	}
 
-// SlackServer a server config
-// type SlackServer struct {
-// 	Name           string  `json:"Name"`
-// 	APIKey         string  `json:"APIKey"`
-// 	CluebatBotChan string  `json:"CluebatBotChan"`
-// 	OwnerID        string  `json:"OwnerID"`
-// 	LatencyCounter int     `json:"latencyCounter"`
-// 	LatencySlice   []int64 `json:",string"`
-// }
-
-func writeExampleCredsFile() {
-	var tempLatencySlice []int64
-	tempLatencySlice = append(tempLatencySlice, 0)
-	tempLatencySlice = append(tempLatencySlice, 1)
-	server1 := cslack.SlackServer{
-		Name:           "example-server1-human-name",
-		APIKey:         "apikey1",
-		CluebatBotChan: "control channel D111111",
-		OwnerID:        "owner id U1111111",
-		LatencyCounter: 0,
-		LatencySlice:   tempLatencySlice}
-	server2 := cslack.SlackServer{
-		Name:           "example-server2-human-name",
-		APIKey:         "apikey2",
-		CluebatBotChan: "control channel D222222",
-		OwnerID:        "owner id U2222222",
-		LatencyCounter: 0,
-		LatencySlice:   tempLatencySlice}
-	slackServers = []cslack.SlackServer{server1, server2}
-	log.Println(slackServers)
-	f, err := os.Create("example.json")
-	if err != nil {
-		die("failed to open example config", err)
+	redis_wrapper.Configure(cfg.Redis.Host, cfg.Redis.Password)
+	slackServers = cfg.SlackServers()
+	if *debug {
+		glog.Infof("Loaded %d servers from %s", len(slackServers), *configFile)
 	}
-	jsonData, err := json.Marshal(slackServers)
+}
+
+func writeExampleConfig() {
+	data, err := config.Marshal(config.Example())
 	if err != nil {
-		die("failed to create json for example config", err)
+		die("failed to create yaml for example config", err)
 	}
-	_, err = f.Write([]byte(jsonData))
+	err = ioutil.WriteFile("example.yaml", data, 0644)
 	if err != nil {
 		die("failed to write to example config", err)
 	}
+	log.Println(string(data))
 }
 
 func die(msg string, err error) {
@@ -0,0 +1,51 @@
+package redis_wrapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// acquireScript takes the lock if it's free and renews it if owner already holds it
+var acquireScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0`)
+
+// releaseScript only deletes the lock if owner still holds it
+var releaseScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// AcquireLock takes or renews key for owner for ttl. It returns false if someone else holds it
+func AcquireLock(key string, owner string, ttl time.Duration) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(acquireScript.Do(conn, key, owner, ttl.Milliseconds()))
+	if err != nil {
+		return ok, fmt.Errorf("error acquiring lock %s: %v", key, err)
+	}
+	return ok, err
+}
+
+// ReleaseLock gives up key if owner holds it
+func ReleaseLock(key string, owner string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := releaseScript.Do(conn, key, owner)
+	if err != nil {
+		return fmt.Errorf("error releasing lock %s: %v", key, err)
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package redis_wrapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// reserveScript is a sliding window log. The key is a sorted set of hits scored by unix
+// milliseconds. Hits older than the window are dropped, and a new one is only added if
+// there's room, all in one step so two callers can't both take the last slot. Returns
+// {1, 0} when the hit was taken, or {0, ms until the oldest hit leaves the window}
+var reserveScript = redis.NewScript(1, `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return {0, tonumber(oldest[2]) + window - now}
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, 0}`)
+
+// ReserveRateLimit takes one of limit hits per sliding window on key, naming the hit id so
+// it can be refunded. If there's no room it returns how long until there will be
+func ReserveRateLimit(key string, id string, limit int, window time.Duration, now time.Time) (bool, time.Duration, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	millis := now.UnixNano() / int64(time.Millisecond)
+	reply, err := redis.Int64s(reserveScript.Do(conn, key, millis, window.Milliseconds(), limit, id))
+	if err != nil {
+		return false, 0, fmt.Errorf("error reserving rate limit %s: %v", key, err)
+	}
+	if len(reply) != 2 {
+		return false, 0, fmt.Errorf("unexpected reply reserving rate limit %s: %v", key, reply)
+	}
+	return reply[0] == 1, time.Duration(reply[1]) * time.Millisecond, nil
+}
+
+// RefundRateLimit gives back a hit ReserveRateLimit took
+func RefundRateLimit(key string, id string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("ZREM", key, id); err != nil {
+		return fmt.Errorf("error refunding rate limit %s: %v", key, err)
+	}
+	return nil
+}
@@ -17,11 +17,18 @@ func init() {
 	if redisHost == "" {
 		redisHost = ":6379"
 	}
-	Pool = newPool(redisHost)
+	Pool = newPool(redisHost, "")
 	cleanupHook()
 }
 
-func newPool(server string) *redis.Pool {
+// Configure replaces the pool init made from REDIS_HOST. Call it before anything uses redis
+func Configure(host string, password string) {
+	old := Pool
+	Pool = newPool(host, password)
+	old.Close()
+}
+
+func newPool(server string, password string) *redis.Pool {
 
 	return &redis.Pool{
 
@@ -29,7 +36,11 @@ func newPool(server string) *redis.Pool {
 		IdleTimeout: 240 * time.Second,
 
 		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", server)
+			var options []redis.DialOption
+			if password != "" {
+				options = append(options, redis.DialPassword(password))
+			}
+			c, err := redis.Dial("tcp", server, options...)
 			if err != nil {
 				return nil, err
 			}
@@ -2,6 +2,7 @@ package redis_wrapper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -100,3 +101,192 @@ func Incr(counterKey string) (int, error) {
 
 	return redis.Int(conn.Do("INCR", counterKey))
 }
+
+func SAdd(key string, member string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SADD", key, member)
+	if err != nil {
+		return fmt.Errorf("error adding %s to set %s: %v", member, key, err)
+	}
+	return err
+}
+
+func SRem(key string, member string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SREM", key, member)
+	if err != nil {
+		return fmt.Errorf("error removing %s from set %s: %v", member, key, err)
+	}
+	return err
+}
+
+func SIsMember(key string, member string) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(conn.Do("SISMEMBER", key, member))
+	if err != nil {
+		return ok, fmt.Errorf("error checking if %s is in set %s: %v", member, key, err)
+	}
+	return ok, err
+}
+
+func SMembers(key string) ([]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", key))
+	if err != nil {
+		return members, fmt.Errorf("error getting members of set %s: %v", key, err)
+	}
+	return members, err
+}
+
+func SetEx(key string, value []byte, ttl time.Duration) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", key, value, "PX", ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("error setting key %s with ttl %s: %v", key, ttl, err)
+	}
+	return err
+}
+
+func HSet(key string, field string, value []byte) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", key, field, value)
+	if err != nil {
+		return fmt.Errorf("error setting field %s of hash %s: %v", field, key, err)
+	}
+	return err
+}
+
+func HGetAll(key string) (map[string]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	values, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return values, fmt.Errorf("error getting hash %s: %v", key, err)
+	}
+	return values, err
+}
+
+func HDel(key string, field string) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(conn.Do("HDEL", key, field))
+	if err != nil {
+		return ok, fmt.Errorf("error deleting field %s of hash %s: %v", field, key, err)
+	}
+	return ok, err
+}
+
+func ZAdd(key string, score int64, member string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", key, score, member)
+	if err != nil {
+		return fmt.Errorf("error adding to sorted set %s: %v", key, err)
+	}
+	return err
+}
+
+func ZRem(key string, member string) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(conn.Do("ZREM", key, member))
+	if err != nil {
+		return ok, fmt.Errorf("error removing from sorted set %s: %v", key, err)
+	}
+	return ok, err
+}
+
+func ZCard(key string) (int, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	count, err := redis.Int(conn.Do("ZCARD", key))
+	if err != nil {
+		return count, fmt.Errorf("error counting sorted set %s: %v", key, err)
+	}
+	return count, err
+}
+
+// ZRangeByScore gets members scored min to max, lowest first. min and max take redis
+// syntax so "-inf", "+inf" and "(123" all work
+func ZRangeByScore(key string, min string, max string) ([]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("ZRANGEBYSCORE", key, min, max))
+	if err != nil {
+		return members, fmt.Errorf("error getting range of sorted set %s: %v", key, err)
+	}
+	return members, err
+}
+
+// ZRemRangeByScore removes members scored min to max and returns how many went
+func ZRemRangeByScore(key string, min string, max string) (int, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	removed, err := redis.Int(conn.Do("ZREMRANGEBYSCORE", key, min, max))
+	if err != nil {
+		return removed, fmt.Errorf("error trimming sorted set %s: %v", key, err)
+	}
+	return removed, err
+}
+
+// ZRevRangeByScore gets up to count members scored max down to min, highest first
+func ZRevRangeByScore(key string, max string, min string, count int) ([]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("ZREVRANGEBYSCORE", key, max, min, "LIMIT", 0, count))
+	if err != nil {
+		return members, fmt.Errorf("error getting reverse range of sorted set %s: %v", key, err)
+	}
+	return members, err
+}
+
+// SetNX sets key only if it doesn't exist yet, expiring it after ttl. It returns true if
+// the key was set
+func SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, value, "NX", "PX", ttl.Milliseconds()))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error setting key %s if not exists: %v", key, err)
+	}
+	return true, nil
+}